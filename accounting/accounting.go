@@ -0,0 +1,334 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package accounting keeps tax lots of EXMO fills and computes realized and unrealized gains.
+//
+// Lots are kept per base currency across all its pairs, and amounts are valued in the reporting currency
+// of the book, e.g. BTC bought for USD and sold for RUB is realized in RUB. Quote currencies are treated
+// as cash: amounts in quote currencies other than the reporting one are converted by the book's Converter.
+package accounting
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/vadiminshakov/exmo"
+)
+
+// Method is the lot matching method.
+type Method int
+
+const (
+	// FIFO sells the oldest lots first.
+	FIFO Method = iota
+	// LIFO sells the newest lots first.
+	LIFO
+	// AverageCost keeps a single lot per currency with weighted average cost.
+	AverageCost
+)
+
+// epsilon is the quantity below which lot is considered closed.
+const epsilon = 1e-12
+
+// Converter converts the amount of currency from to currency to at the time, e.g. with historical rates.
+type Converter func(amount float64, from, to string, at time.Time) (float64, error)
+
+// Lot is a quantity of base currency acquired by a single buy (or pooled, for AverageCost).
+type Lot struct {
+	Currency  string
+	Pair      string // pair of the buy, the first one for AverageCost
+	TradeId   int64
+	Acquired  time.Time
+	Quantity  float64 // remaining quantity after commission
+	CostBasis float64 // reporting currency paid for the remaining quantity, including commission
+}
+
+// Realization is a gain realized by a single sell. Amounts are in the reporting currency.
+type Realization struct {
+	Currency  string
+	Pair      string
+	TradeId   int64
+	Date      time.Time
+	Quantity  float64 // base currency sold
+	Proceeds  float64 // received after commission
+	CostBasis float64 // cost of the matched lots
+	Gain      float64 // Proceeds - CostBasis
+	Fees      float64 // commission of the sell
+}
+
+// Position is the open quantity of a currency valued at market price in the reporting currency.
+type Position struct {
+	Currency    string
+	Quantity    float64
+	CostBasis   float64
+	Price       float64
+	MarketValue float64
+	Unrealized  float64 // MarketValue - CostBasis
+}
+
+// Book maintains tax lots and realized gains. It is not safe for concurrent use.
+type Book struct {
+	method   Method
+	currency string
+	convert  Converter
+	lots     map[string][]Lot
+	realized []Realization
+	last     map[string]int64 // last processed trade id per pair
+}
+
+// NewBook creates empty book using the lot matching method and valuing amounts in the reporting currency.
+// Trades of pairs quoted in another currency are converted by convert; if it is nil, such trades are rejected.
+func NewBook(method Method, currency string, convert Converter) *Book {
+	return &Book{method: method, currency: currency, convert: convert, lots: map[string][]Lot{}, last: map[string]int64{}}
+}
+
+// Currency returns the reporting currency of the book.
+func (b *Book) Currency() string {
+	return b.currency
+}
+
+// Add applies trades in chronological order. Trades already processed (by trade id) are skipped,
+// so overlapping batches of history may be added safely. A sell of more than the open lots hold
+// (e.g. of currency bought before the history starts) fails with error; trades before it stay applied.
+func (b *Book) Add(trades ...exmo.UserTrade) error {
+	sorted := append([]exmo.UserTrade(nil), trades...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Date.Equal(sorted[j].Date) {
+			return sorted[i].Date.Before(sorted[j].Date)
+		}
+		return sorted[i].TradeId < sorted[j].TradeId
+	})
+
+	for _, t := range sorted {
+		if t.TradeId <= b.last[t.Pair] {
+			continue
+		}
+		base, quote, err := exmo.SplitPair(t.Pair)
+		if err != nil {
+			return err
+		}
+
+		switch t.Type {
+		case "buy":
+			err = b.buy(t, base, quote)
+		case "sell":
+			err = b.sell(t, base, quote)
+		default:
+			err = fmt.Errorf("unknown type %q", t.Type)
+		}
+		if err != nil {
+			return fmt.Errorf("trade %d: %s", t.TradeId, err)
+		}
+		b.last[t.Pair] = t.TradeId
+	}
+	return nil
+}
+
+// value converts the amount of currency to the reporting currency.
+func (b *Book) value(amount float64, currency string, at time.Time) (float64, error) {
+	if currency == b.currency || amount == 0 {
+		return amount, nil
+	}
+	if b.convert == nil {
+		return 0, fmt.Errorf("can't convert %s to %s", currency, b.currency)
+	}
+	return b.convert(amount, currency, b.currency, at)
+}
+
+func (b *Book) buy(t exmo.UserTrade, base, quote string) error {
+	quantity, cost := t.Quantity, t.Amount
+	// the exchange charges commission in the received currency
+	switch t.CommissionCurrency {
+	case base:
+		quantity -= t.CommissionAmount
+	case quote:
+		cost += t.CommissionAmount
+	}
+	cost, err := b.value(cost, quote, t.Date)
+	if err != nil {
+		return err
+	}
+	lot := Lot{Currency: base, Pair: t.Pair, TradeId: t.TradeId, Acquired: t.Date, Quantity: quantity, CostBasis: cost}
+
+	if b.method == AverageCost && len(b.lots[base]) > 0 {
+		pooled := &b.lots[base][0]
+		pooled.Quantity += lot.Quantity
+		pooled.CostBasis += lot.CostBasis
+		return nil
+	}
+	b.lots[base] = append(b.lots[base], lot)
+	return nil
+}
+
+func (b *Book) sell(t exmo.UserTrade, base, quote string) error {
+	r := Realization{Currency: base, Pair: t.Pair, TradeId: t.TradeId, Date: t.Date, Quantity: t.Quantity}
+	proceeds, fees := t.Amount, 0.0
+	switch t.CommissionCurrency {
+	case quote:
+		proceeds -= t.CommissionAmount
+		fees = t.CommissionAmount
+	case base:
+		r.Quantity += t.CommissionAmount
+		fees = t.CommissionAmount * t.Price
+	}
+
+	var open float64
+	for _, lot := range b.lots[base] {
+		open += lot.Quantity
+	}
+	if r.Quantity-open > epsilon {
+		return fmt.Errorf("%v %s sold without lots, only %v is open", r.Quantity, base, open)
+	}
+	var err error
+	if r.Proceeds, err = b.value(proceeds, quote, t.Date); err != nil {
+		return err
+	}
+	if r.Fees, err = b.value(fees, quote, t.Date); err != nil {
+		return err
+	}
+
+	remaining := r.Quantity
+	lots := b.lots[base]
+	for remaining > epsilon && len(lots) > 0 {
+		i := 0
+		if b.method == LIFO {
+			i = len(lots) - 1
+		}
+		lot := &lots[i]
+
+		quantity := remaining
+		if quantity > lot.Quantity {
+			quantity = lot.Quantity
+		}
+		cost := lot.CostBasis * quantity / lot.Quantity
+		r.CostBasis += cost
+		lot.CostBasis -= cost
+		lot.Quantity -= quantity
+		remaining -= quantity
+
+		if lot.Quantity <= epsilon {
+			lots = append(lots[:i], lots[i+1:]...)
+		}
+	}
+	b.lots[base] = lots
+
+	r.Gain = r.Proceeds - r.CostBasis
+	b.realized = append(b.realized, r)
+	return nil
+}
+
+// Lots returns open lots of the currency in acquisition order.
+func (b *Book) Lots(currency string) []Lot {
+	return append([]Lot(nil), b.lots[currency]...)
+}
+
+// Realized returns all realizations in the order of sells.
+func (b *Book) Realized() []Realization {
+	return append([]Realization(nil), b.realized...)
+}
+
+// Positions values open lots at prices (currency -> price in the reporting currency, e.g. best bid from Ticker).
+// Currencies without price are reported with zero market value.
+func (b *Book) Positions(prices map[string]float64) []Position {
+	var positions []Position
+	for currency, lots := range b.lots {
+		p := Position{Currency: currency, Price: prices[currency]}
+		for _, lot := range lots {
+			p.Quantity += lot.Quantity
+			p.CostBasis += lot.CostBasis
+		}
+		if p.Quantity <= epsilon {
+			continue
+		}
+		p.MarketValue = p.Quantity * p.Price
+		p.Unrealized = p.MarketValue - p.CostBasis
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].Currency < positions[j].Currency })
+	return positions
+}
+
+// Period is the length of report period.
+type Period int
+
+const (
+	// Day groups realizations by calendar day (UTC).
+	Day Period = iota
+	// Month groups realizations by calendar month (UTC).
+	Month
+	// Year groups realizations by calendar year (UTC).
+	Year
+)
+
+// start returns beginning of the period containing t, in UTC.
+func (p Period) start(t time.Time) time.Time {
+	t = t.UTC()
+	switch p {
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// PeriodGain is the sum of realizations of a currency within a period.
+type PeriodGain struct {
+	Start     time.Time
+	Currency  string
+	Sells     int
+	Quantity  float64
+	Proceeds  float64
+	CostBasis float64
+	Gain      float64
+	Fees      float64
+}
+
+// Report sums realized gains by period and currency, ordered by period start and currency.
+func (b *Book) Report(period Period) []PeriodGain {
+	type key struct {
+		start    time.Time
+		currency string
+	}
+	sums := map[key]*PeriodGain{}
+	var report []PeriodGain
+	for _, r := range b.realized {
+		k := key{period.start(r.Date), r.Currency}
+		g, ok := sums[k]
+		if !ok {
+			g = &PeriodGain{Start: k.start, Currency: k.currency}
+			sums[k] = g
+		}
+		g.Sells++
+		g.Quantity += r.Quantity
+		g.Proceeds += r.Proceeds
+		g.CostBasis += r.CostBasis
+		g.Gain += r.Gain
+		g.Fees += r.Fees
+	}
+	for _, g := range sums {
+		report = append(report, *g)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if !report[i].Start.Equal(report[j].Start) {
+			return report[i].Start.Before(report[j].Start)
+		}
+		return report[i].Currency < report[j].Currency
+	})
+	return report
+}
@@ -0,0 +1,155 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package accounting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vadiminshakov/exmo"
+)
+
+func trade(id int64, day int, typ string, quantity, price float64) exmo.UserTrade {
+	t := exmo.UserTrade{
+		TradeId:  id,
+		Date:     time.Date(2019, 1, day, 12, 0, 0, 0, time.UTC),
+		Type:     typ,
+		Pair:     "BTC_RUB",
+		Quantity: quantity,
+		Price:    price,
+		Amount:   quantity * price,
+	}
+	return t
+}
+
+// buys 1 BTC at 100 and 1 BTC at 200, then sells 1.5 BTC at 300
+var history = []exmo.UserTrade{
+	trade(1, 1, "buy", 1, 100),
+	trade(2, 2, "buy", 1, 200),
+	trade(3, 3, "sell", 1.5, 300),
+}
+
+func TestBook(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		method   Method
+		cost     float64
+		leftCost float64
+	}{
+		{"FIFO", FIFO, 100 + 100, 100},
+		{"LIFO", LIFO, 200 + 50, 50},
+		{"AverageCost", AverageCost, 225, 75},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewBook(tc.method, "RUB", nil)
+			// trades come newest first from the exchange
+			require.NoError(t, b.Add(history[2], history[1], history[0]))
+
+			realized := b.Realized()
+			require.Len(t, realized, 1)
+			require.InDelta(t, 450, realized[0].Proceeds, 1e-9)
+			require.InDelta(t, tc.cost, realized[0].CostBasis, 1e-9)
+			require.InDelta(t, 450-tc.cost, realized[0].Gain, 1e-9)
+
+			positions := b.Positions(map[string]float64{"BTC": 400})
+			require.Len(t, positions, 1)
+			require.InDelta(t, 0.5, positions[0].Quantity, 1e-12)
+			require.InDelta(t, tc.leftCost, positions[0].CostBasis, 1e-9)
+			require.InDelta(t, 200-tc.leftCost, positions[0].Unrealized, 1e-9)
+		})
+	}
+
+	t.Run("Fees", func(t *testing.T) {
+		buy := trade(1, 1, "buy", 1, 100)
+		buy.CommissionAmount, buy.CommissionCurrency = 0.004, "BTC"
+		sell := trade(2, 2, "sell", 0.996, 200)
+		sell.CommissionAmount, sell.CommissionCurrency = 0.7968, "RUB"
+
+		b := NewBook(FIFO, "RUB", nil)
+		require.NoError(t, b.Add(buy, sell))
+		require.Empty(t, b.Lots("BTC"))
+
+		r := b.Realized()[0]
+		require.InDelta(t, 199.2-0.7968, r.Proceeds, 1e-9)
+		require.InDelta(t, 100, r.CostBasis, 1e-9)
+		require.InDelta(t, 0.7968, r.Fees, 1e-12)
+	})
+
+	t.Run("Unmatched", func(t *testing.T) {
+		// selling more than the lots hold fails instead of valuing the rest at zero cost
+		b := NewBook(FIFO, "RUB", nil)
+		require.Error(t, b.Add(trade(1, 1, "buy", 1, 100), trade(2, 2, "sell", 3, 100)))
+		require.Empty(t, b.Realized())
+		require.Len(t, b.Lots("BTC"), 1)
+	})
+
+	t.Run("CrossPair", func(t *testing.T) {
+		// BTC bought for USD is sold for RUB, USD is converted at 100 RUB
+		buy := trade(1, 1, "buy", 1, 10)
+		buy.Pair = "BTC_USD"
+		sell := trade(2, 2, "sell", 1, 1500)
+		var converted []string
+		usd := func(amount float64, from, to string, at time.Time) (float64, error) {
+			converted = append(converted, from+"->"+to)
+			return amount * 100, nil
+		}
+
+		b := NewBook(FIFO, "RUB", usd)
+		require.NoError(t, b.Add(buy, sell))
+		require.Equal(t, []string{"USD->RUB"}, converted)
+		r := b.Realized()[0]
+		require.Equal(t, "BTC", r.Currency)
+		require.InDelta(t, 1000, r.CostBasis, 1e-9)
+		require.InDelta(t, 500, r.Gain, 1e-9)
+		require.Empty(t, b.Lots("BTC"))
+
+		// pairs quoted in another currency can't be valued without converter
+		require.Error(t, NewBook(FIFO, "RUB", nil).Add(buy))
+	})
+
+	t.Run("Duplicates", func(t *testing.T) {
+		b := NewBook(FIFO, "RUB", nil)
+		require.NoError(t, b.Add(history...))
+		require.NoError(t, b.Add(history...))
+		require.Len(t, b.Realized(), 1)
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		b := NewBook(FIFO, "RUB", nil)
+		require.NoError(t, b.Add(
+			trade(1, 1, "buy", 3, 100),
+			trade(2, 2, "sell", 1, 150),
+			trade(3, 3, "sell", 1, 50),
+			exmo.UserTrade{TradeId: 4, Date: time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC), Type: "sell", Pair: "BTC_RUB", Quantity: 1, Price: 300, Amount: 300},
+		))
+
+		report := b.Report(Month)
+		require.Len(t, report, 2)
+		require.Equal(t, time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), report[0].Start)
+		require.Equal(t, 2, report[0].Sells)
+		require.InDelta(t, 0, report[0].Gain, 1e-9)
+		require.InDelta(t, 200, report[1].Gain, 1e-9)
+
+		require.Len(t, b.Report(Day), 3)
+		require.Len(t, b.Report(Year), 1)
+	})
+
+	t.Run("UnknownType", func(t *testing.T) {
+		require.Error(t, NewBook(FIFO, "RUB", nil).Add(exmo.UserTrade{TradeId: 1, Pair: "BTC_RUB", Type: "swap"}))
+	})
+}
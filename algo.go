@@ -0,0 +1,389 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TradesSource provides the latest public trades of a pair. *Exmo satisfies it.
+type TradesSource interface {
+	GetTrades(pair string) (ApiResponse, error)
+}
+
+// AlgoParams describes a parent order executed by TWAP or VWAP algorithm with market child orders.
+type AlgoParams struct {
+	Pair     string
+	Side     string  // buy or sell
+	Quantity float64 // base currency
+	Duration time.Duration
+	Slices   int // number of child orders the quantity is split into
+}
+
+// AlgoState is the state of algorithmic execution.
+type AlgoState int
+
+const (
+	// AlgoRunning places child orders on schedule.
+	AlgoRunning AlgoState = iota
+	// AlgoPaused skips the schedule until resumed, the missed quantity is spread over the remaining slices.
+	AlgoPaused
+	// AlgoCompleted has filled the parent quantity (up to the pair's minimal quantity), the final state.
+	AlgoCompleted
+	// AlgoCancelled was stopped by Cancel or the context, the final state.
+	AlgoCancelled
+	// AlgoFailed was stopped by an error of a child order, the final state.
+	AlgoFailed
+)
+
+func (s AlgoState) String() string {
+	switch s {
+	case AlgoRunning:
+		return "running"
+	case AlgoPaused:
+		return "paused"
+	case AlgoCompleted:
+		return "completed"
+	case AlgoCancelled:
+		return "cancelled"
+	case AlgoFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// ChildOrder is a market order placed by the algorithm.
+type ChildOrder struct {
+	OrderId   string
+	Time      time.Time
+	Quantity  string  // quantity sent to the exchange
+	Filled    float64 // base currency
+	Amount    float64 // quote currency
+	Confirmed bool    // fills were read from GetOrderTrades, otherwise Quantity is assumed filled
+	Err       error
+}
+
+// AlgoReport is the parent fill report.
+type AlgoReport struct {
+	Pair      string
+	Side      string
+	Quantity  float64
+	Filled    float64 // base currency
+	Amount    float64 // quote currency
+	AvgPrice  float64
+	Remaining float64
+	Children  []ChildOrder
+	State     AlgoState
+	Err       error // the reason of AlgoFailed state
+}
+
+// AlgoExecution is a running TWAP or VWAP algorithm. It is safe for concurrent use.
+type AlgoExecution struct {
+	trader   Trader
+	settings PairSettings
+	params   AlgoParams
+	interval time.Duration
+	volume   *volumeMeter // nil for TWAP
+
+	mu      sync.Mutex
+	report  AlgoReport
+	resumed chan struct{} // closed on Resume, nil if not paused
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// StartTWAP starts time-weighted execution: the quantity is split evenly into Slices market orders
+// placed every Duration/Slices.
+func StartTWAP(ctx context.Context, trader Trader, market MarketData, params AlgoParams) (*AlgoExecution, error) {
+	return startAlgo(ctx, trader, market, params, nil)
+}
+
+// StartVWAP starts volume-weighted execution: every Duration/Slices a child order is sized in proportion
+// to the market volume traded since the previous one (from public trades) relative to the average volume
+// per slice, so that execution follows the market activity. The first child order, as well as all of them
+// while there is no market volume, is sized as in TWAP.
+func StartVWAP(ctx context.Context, trader Trader, market MarketData, trades TradesSource, params AlgoParams) (*AlgoExecution, error) {
+	return startAlgo(ctx, trader, market, params, &volumeMeter{source: trades, pair: params.Pair})
+}
+
+func startAlgo(ctx context.Context, trader Trader, market MarketData, params AlgoParams, volume *volumeMeter) (*AlgoExecution, error) {
+	if params.Side != "buy" && params.Side != "sell" {
+		return nil, fmt.Errorf("invalid side %q", params.Side)
+	}
+	if params.Quantity <= 0 || params.Duration <= 0 || params.Slices <= 0 {
+		return nil, fmt.Errorf("quantity, duration and slices must be positive")
+	}
+	resp, err := market.GetPairSettings()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := ParsePairSettings(resp)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := settings[params.Pair]
+	if !ok {
+		return nil, fmt.Errorf("unknown currency pair %s", params.Pair)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	a := &AlgoExecution{
+		trader:   trader,
+		settings: s,
+		params:   params,
+		interval: params.Duration / time.Duration(params.Slices),
+		volume:   volume,
+		report:   AlgoReport{Pair: params.Pair, Side: params.Side, Quantity: params.Quantity, Remaining: params.Quantity},
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go a.run(ctx)
+	return a, nil
+}
+
+// Pause stops placing child orders until Resume.
+func (a *AlgoExecution) Pause() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.report.State == AlgoRunning {
+		a.report.State = AlgoPaused
+		a.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues paused execution.
+func (a *AlgoExecution) Resume() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.report.State == AlgoPaused {
+		a.report.State = AlgoRunning
+		close(a.resumed)
+		a.resumed = nil
+	}
+}
+
+// Cancel stops execution, child orders already filled stay filled.
+func (a *AlgoExecution) Cancel() {
+	a.cancel()
+}
+
+// Done is closed when execution reaches the final state.
+func (a *AlgoExecution) Done() <-chan struct{} {
+	return a.done
+}
+
+// Wait blocks until execution reaches the final state and returns the report.
+func (a *AlgoExecution) Wait() AlgoReport {
+	<-a.done
+	return a.Report()
+}
+
+// Report returns the current state of execution.
+func (a *AlgoExecution) Report() AlgoReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r := a.report
+	r.Children = append([]ChildOrder(nil), r.Children...)
+	return r
+}
+
+func (a *AlgoExecution) run(ctx context.Context) {
+	defer close(a.done)
+	defer a.cancel()
+
+	start := time.Now()
+	next := start
+	for {
+		if err := a.waitUntil(ctx, next); err != nil {
+			a.finish(AlgoCancelled, nil)
+			return
+		}
+
+		a.mu.Lock()
+		remaining := a.report.Remaining
+		a.mu.Unlock()
+
+		// slices left according to the schedule, late slices (e.g. after pause) are caught up with the next one
+		slot := int(time.Since(start) / a.interval)
+		left := a.params.Slices - slot
+		if left < 1 {
+			left = 1
+		}
+		if remaining < a.settings.MinQuantity || remaining <= epsilon {
+			a.finish(AlgoCompleted, nil)
+			return
+		}
+
+		quantity := remaining / float64(left)
+		if a.volume != nil {
+			if q, ok := a.volume.share(remaining, left); ok {
+				quantity = q
+				// a quiet slice is skipped, its share is carried forward to the next ones
+				if left > 1 && (quantity < a.settings.MinQuantity || quantity <= epsilon) {
+					next = start.Add(time.Duration(slot+1) * a.interval)
+					continue
+				}
+			}
+		}
+		if quantity < a.settings.MinQuantity {
+			quantity = a.settings.MinQuantity
+		}
+		if left == 1 || quantity > remaining {
+			quantity = remaining
+		}
+
+		child := a.place(quantity)
+		a.mu.Lock()
+		a.report.Children = append(a.report.Children, child)
+		a.report.Filled += child.Filled
+		a.report.Amount += child.Amount
+		a.report.Remaining = a.params.Quantity - a.report.Filled
+		if a.report.Remaining < 0 {
+			a.report.Remaining = 0
+		}
+		if a.report.Filled > 0 {
+			a.report.AvgPrice = a.report.Amount / a.report.Filled
+		}
+		a.mu.Unlock()
+		if child.Err != nil {
+			a.finish(AlgoFailed, child.Err)
+			return
+		}
+
+		next = start.Add(time.Duration(slot+1) * a.interval)
+	}
+}
+
+// waitUntil waits for the time and then while paused.
+func (a *AlgoExecution) waitUntil(ctx context.Context, at time.Time) error {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	for {
+		a.mu.Lock()
+		resumed := a.resumed
+		a.mu.Unlock()
+		if resumed == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resumed:
+		}
+	}
+}
+
+// place sends a market child order and reads its fills.
+func (a *AlgoExecution) place(quantity float64) ChildOrder {
+	child := ChildOrder{Time: time.Now(), Quantity: a.settings.RoundQuantity(quantity, RoundDown)}
+
+	var resp ApiResponse
+	if a.params.Side == "buy" {
+		resp, child.Err = a.trader.MarketBuy(a.params.Pair, child.Quantity)
+	} else {
+		resp, child.Err = a.trader.MarketSell(a.params.Pair, child.Quantity)
+	}
+	if child.Err != nil {
+		return child
+	}
+	if child.OrderId, child.Err = orderIdOf(resp); child.Err != nil {
+		return child
+	}
+
+	trades, err := fetchOrderTrades(a.trader, child.OrderId)
+	if err == nil && len(trades) > 0 {
+		child.Confirmed = true
+		for _, t := range trades {
+			child.Filled += t.Quantity
+			child.Amount += t.Amount
+		}
+		return child
+	}
+	// market order is filled once accepted, don't risk placing the quantity again
+	child.Filled, _ = strconv.ParseFloat(child.Quantity, 64)
+	return child
+}
+
+func (a *AlgoExecution) finish(state AlgoState, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.resumed != nil {
+		close(a.resumed)
+		a.resumed = nil
+	}
+	a.report.State = state
+	a.report.Err = err
+}
+
+// volumeMeter measures market volume of the pair traded between calls.
+type volumeMeter struct {
+	source    TradesSource
+	pair      string
+	lastTrade int64
+	total     float64 // volume observed in all slices
+	slices    int
+}
+
+// share returns the part of the remaining quantity matching the volume traded since the previous call,
+// false if there is no volume to weight by.
+func (m *volumeMeter) share(remaining float64, left int) (float64, bool) {
+	resp, err := m.source.GetTrades(m.pair)
+	if err != nil {
+		return 0, false
+	}
+	list, _ := resp[m.pair].([]interface{})
+	trades, err := parseTradeList(list)
+	if err != nil {
+		return 0, false
+	}
+
+	var volume float64
+	last := m.lastTrade
+	for _, t := range trades {
+		if t.TradeId > m.lastTrade {
+			volume += t.Quantity
+		}
+		if t.TradeId > last {
+			last = t.TradeId
+		}
+	}
+	first := m.lastTrade == 0
+	m.lastTrade = last
+	if first {
+		// the first request sets the baseline, volume before the start is not known to belong to one slice
+		return 0, false
+	}
+
+	m.total += volume
+	m.slices++
+	average := m.total / float64(m.slices)
+	if average == 0 {
+		return 0, false
+	}
+	return remaining * volume / (volume + average*float64(left-1)), true
+}
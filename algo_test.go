@@ -0,0 +1,138 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stubTrades serves public trades with the given volume traded before each request.
+type stubTrades struct {
+	mu      sync.Mutex
+	volumes []float64
+	lastId  int
+	trades  []string
+}
+
+func (s *stubTrades) GetTrades(pair string) (ApiResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.volumes) > 0 {
+		s.lastId++
+		s.trades = append([]string{fmt.Sprintf(`{"trade_id":%d,"type":"buy","quantity":"%v","price":"1000000","amount":"0","date":1570000000}`, s.lastId, s.volumes[0])}, s.trades...)
+		s.volumes = s.volumes[1:]
+	}
+	return decodeResponse(`{"` + pair + `":[` + strings.Join(s.trades, ",") + `]}`), nil
+}
+
+func TestAlgo(t *testing.T) {
+	params := AlgoParams{Pair: "BTC_RUB", Side: "buy", Quantity: 1, Duration: 200 * time.Millisecond, Slices: 4}
+
+	t.Run("TWAP", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		algo, err := StartTWAP(context.Background(), p, market, params)
+		require.NoError(t, err)
+
+		report := algo.Wait()
+		require.Equal(t, AlgoCompleted, report.State)
+		require.Len(t, report.Children, 4)
+		for _, child := range report.Children {
+			require.Equal(t, "0.25", child.Quantity)
+			require.True(t, child.Confirmed)
+		}
+		require.InDelta(t, 1, report.Filled, 1e-12)
+		require.InDelta(t, 0, report.Remaining, 1e-12)
+		require.InDelta(t, 1000000, report.AvgPrice, 1e-6)
+		require.InDelta(t, 0.996, paperBalance(t, p, "balances", "BTC"), 1e-12)
+	})
+
+	t.Run("VWAP", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		trades := &stubTrades{volumes: []float64{1, 3, 0, 5}}
+		algo, err := StartVWAP(context.Background(), p, market, trades, params)
+		require.NoError(t, err)
+
+		report := algo.Wait()
+		require.Equal(t, AlgoCompleted, report.State)
+		require.Len(t, report.Children, 3)
+		// the first slice has no volume history, the second one follows the average, the third one is quiet
+		// and skipped, so its share is placed with the last one
+		require.Equal(t, "0.25", report.Children[0].Quantity)
+		require.Equal(t, "0.25", report.Children[1].Quantity)
+		require.Equal(t, "0.5", report.Children[2].Quantity)
+		require.InDelta(t, 1, report.Filled, 1e-12)
+	})
+
+	t.Run("PauseResume", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		algo, err := StartTWAP(context.Background(), p, market, params)
+		require.NoError(t, err)
+		algo.Pause()
+		require.Equal(t, AlgoPaused, algo.Report().State)
+
+		time.Sleep(params.Duration + 50*time.Millisecond)
+		require.True(t, len(algo.Report().Children) <= 1)
+
+		// the whole remainder is caught up at once
+		algo.Resume()
+		report := algo.Wait()
+		require.Equal(t, AlgoCompleted, report.State)
+		require.InDelta(t, 1, report.Filled, 1e-12)
+		require.True(t, len(report.Children) <= 2)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		long := params
+		long.Duration, long.Slices = 10*time.Second, 10
+		algo, err := StartTWAP(context.Background(), p, market, long)
+		require.NoError(t, err)
+
+		for len(algo.Report().Children) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		algo.Cancel()
+		report := algo.Wait()
+		require.Equal(t, AlgoCancelled, report.State)
+		require.InDelta(t, 0.1, report.Filled, 1e-12)
+		require.InDelta(t, 0.9, report.Remaining, 1e-12)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 300000})
+		algo, err := StartTWAP(context.Background(), p, market, params)
+		require.NoError(t, err)
+
+		// the second child can't be paid for
+		report := algo.Wait()
+		require.Equal(t, AlgoFailed, report.State)
+		require.Equal(t, ErrInsufficientFunds, report.Err)
+		require.InDelta(t, 0.25, report.Filled, 1e-12)
+	})
+}
@@ -0,0 +1,204 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AmendResult is the outcome of cancel-replace.
+type AmendResult struct {
+	OrderId    string
+	Pair       string
+	Type       string  // buy or sell
+	Quantity   float64 // original quantity of the order
+	Filled     float64 // quantity filled before the cancel took effect
+	Remaining  string  // quantity of the replacement order, empty if nothing was placed
+	Price      string  // price of the replacement order
+	NewOrderId string
+	Replaced   bool
+	Reason     string // why the replacement was not placed, e.g. the order was filled
+}
+
+// OrderAmender moves limit orders to a new price with cancel-replace. Fills that happen while the order
+// is being cancelled are taken into account, so only the quantity left unfilled is placed again.
+type OrderAmender struct {
+	trader   Trader
+	market   MarketData
+	settings map[string]PairSettings
+
+	// ConfirmAttempts is the number of GetUserOpenOrders requests made until the cancelled order disappears, 5 by default.
+	ConfirmAttempts int
+	// ConfirmInterval is the pause between the requests, 200ms by default.
+	ConfirmInterval time.Duration
+}
+
+// NewOrderAmender creates amender placing orders with the trader. Market data is used for pair settings.
+func NewOrderAmender(trader Trader, market MarketData) *OrderAmender {
+	return &OrderAmender{trader: trader, market: market, ConfirmAttempts: 5, ConfirmInterval: 200 * time.Millisecond}
+}
+
+// Amend cancels the open limit order of the original quantity, waits until the cancel is confirmed, reads fills
+// of the order and places the unfilled remainder at the new price. If the order was filled before it
+// could be cancelled, or the remainder is below the pair's minimum, nothing is placed and Reason says why.
+func (a *OrderAmender) Amend(ctx context.Context, orderId string, quantity float64, price string) (AmendResult, error) {
+	result := AmendResult{OrderId: orderId, Quantity: quantity, Price: price}
+	if quantity <= 0 {
+		return result, fmt.Errorf("invalid quantity %v", quantity)
+	}
+	if err := a.loadSettings(); err != nil {
+		return result, err
+	}
+
+	order, open, err := a.openOrder(orderId)
+	if err != nil {
+		return result, err
+	}
+	if !open {
+		// closed before we got to it; report fills, there is nothing to replace
+		trades, err := fetchOrderTrades(a.trader, orderId)
+		if err != nil {
+			return result, err
+		}
+		result.Filled = filledBase(trades)
+		if len(trades) > 0 {
+			result.Pair, result.Type = trades[0].Pair, trades[0].Type
+		}
+		result.Reason = "order is not open"
+		return result, nil
+	}
+	result.Pair, result.Type = order.Pair, order.Type
+	if result.Type != "buy" && result.Type != "sell" {
+		return result, fmt.Errorf("can't amend %s order", result.Type)
+	}
+	settings, ok := a.settings[order.Pair]
+	if !ok {
+		return result, fmt.Errorf("unknown currency pair %s", order.Pair)
+	}
+
+	if _, err := a.trader.OrderCancel(orderId); err != nil && !isOrderNotFound(err) {
+		return result, err
+	}
+	// not found means it was filled or cancelled meanwhile, either way wait until it leaves the book
+	if err := a.confirmCancel(ctx, orderId); err != nil {
+		return result, err
+	}
+
+	trades, err := fetchOrderTrades(a.trader, orderId)
+	if err != nil {
+		return result, err
+	}
+	result.Filled = filledBase(trades)
+
+	remaining := settings.RoundQuantity(quantity-result.Filled, RoundDown)
+	if q, _ := strconv.ParseFloat(remaining, 64); q <= 0 {
+		result.Reason = "order was filled"
+		return result, nil
+	}
+	q, p, err := ValidateOrder(settings, order.Pair, remaining, price, order.Type)
+	if err != nil {
+		if e, ok := err.(*OrderValidationError); ok && e.Field != "price" {
+			result.Reason = "remaining quantity " + remaining + " is out of limits: " + err.Error()
+			return result, nil
+		}
+		return result, err
+	}
+
+	resp, err := a.trader.OrderCreate(order.Pair, q, p, order.Type)
+	if err != nil {
+		return result, err
+	}
+	result.Remaining, result.Price = q, p
+	if result.NewOrderId, err = orderIdOf(resp); err != nil {
+		return result, err
+	}
+	result.Replaced = true
+	return result, nil
+}
+
+// AmendOrder moves the open limit order of the original quantity to the new price, see OrderAmender.
+func (ex *Exmo) AmendOrder(ctx context.Context, orderId string, quantity float64, price string) (AmendResult, error) {
+	return NewOrderAmender(ex, ex).Amend(ctx, orderId, quantity, price)
+}
+
+func (a *OrderAmender) openOrder(orderId string) (OpenOrder, bool, error) {
+	resp, err := a.trader.GetUserOpenOrders()
+	if err != nil {
+		return OpenOrder{}, false, err
+	}
+	orders, err := ParseOpenOrders(resp)
+	if err != nil {
+		return OpenOrder{}, false, err
+	}
+	for _, o := range orders {
+		if o.OrderId == orderId {
+			return o, true, nil
+		}
+	}
+	return OpenOrder{}, false, nil
+}
+
+// confirmCancel polls open orders until the order is gone.
+func (a *OrderAmender) confirmCancel(ctx context.Context, orderId string) error {
+	attempts := a.ConfirmAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(a.ConfirmInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		_, open, err := a.openOrder(orderId)
+		if err != nil {
+			return err
+		}
+		if !open {
+			return nil
+		}
+	}
+	return fmt.Errorf("order %s is still open after cancel", orderId)
+}
+
+func (a *OrderAmender) loadSettings() error {
+	if a.settings != nil {
+		return nil
+	}
+	resp, err := a.market.GetPairSettings()
+	if err != nil {
+		return err
+	}
+	a.settings, err = ParsePairSettings(resp)
+	return err
+}
+
+// filledBase sums base currency quantity of the trades.
+func filledBase(trades []UserTrade) float64 {
+	var filled float64
+	for _, t := range trades {
+		filled += t.Quantity
+	}
+	return filled
+}
@@ -0,0 +1,116 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// racingPaper fills resting orders right before the cancel request reaches the book.
+type racingPaper struct {
+	*Paper
+	market *stubMarket
+	book   string
+}
+
+func (p *racingPaper) OrderCancel(orderId string) (ApiResponse, error) {
+	p.market.books["BTC_RUB"] = p.book
+	if err := p.Sync(); err != nil {
+		return nil, err
+	}
+	return p.Paper.OrderCancel(orderId)
+}
+
+func TestOrderAmender(t *testing.T) {
+	t.Run("ReplacesRemainder", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"BTC": 1})
+		// half of the order fills immediately
+		resp, err := p.Sell("BTC_RUB", "1", "999000")
+		require.NoError(t, err)
+		id, _ := orderIdOf(resp)
+
+		result, err := NewOrderAmender(p, market).Amend(context.Background(), id, 1, "1010000")
+		require.NoError(t, err)
+		require.True(t, result.Replaced)
+		require.Equal(t, 0.5, result.Filled)
+		require.Equal(t, "0.5", result.Remaining)
+		require.Equal(t, "sell", result.Type)
+		require.NotEqual(t, id, result.NewOrderId)
+
+		orders, err := p.GetUserOpenOrders()
+		require.NoError(t, err)
+		open, err := ParseOpenOrders(orders)
+		require.NoError(t, err)
+		require.Len(t, open, 1)
+		require.Equal(t, result.NewOrderId, open[0].OrderId)
+		require.Equal(t, 1010000.0, open[0].Price)
+		require.Equal(t, 0.5, open[0].Quantity)
+	})
+
+	t.Run("FilledDuringCancel", func(t *testing.T) {
+		market := newStubMarket()
+		p := &racingPaper{
+			Paper:  NewPaper(market, map[string]float64{"BTC": 1}),
+			market: market,
+			book:   `{"ask":[["1100000","1","1100000"]],"bid":[["1050000","0.3","315000"]]}`,
+		}
+		resp, err := p.Sell("BTC_RUB", "1", "999000")
+		require.NoError(t, err)
+		id, _ := orderIdOf(resp)
+
+		// 0.3 more fills while the order is being cancelled, only 0.2 is left
+		result, err := NewOrderAmender(p, market).Amend(context.Background(), id, 1, "1010000")
+		require.NoError(t, err)
+		require.True(t, result.Replaced)
+		require.InDelta(t, 0.8, result.Filled, 1e-12)
+		require.Equal(t, "0.2", result.Remaining)
+
+		// the order fills completely, there is nothing to replace
+		market = newStubMarket()
+		p = &racingPaper{
+			Paper:  NewPaper(market, map[string]float64{"BTC": 0.2}),
+			market: market,
+			book:   `{"ask":[["1300000","1","1300000"]],"bid":[["1250000","1","1250000"]]}`,
+		}
+		resp, err = p.Sell("BTC_RUB", "0.2", "1200000")
+		require.NoError(t, err)
+		id, _ = orderIdOf(resp)
+		result, err = NewOrderAmender(p, market).Amend(context.Background(), id, 0.2, "1300000")
+		require.NoError(t, err)
+		require.False(t, result.Replaced)
+		require.Equal(t, 0.2, result.Filled)
+		require.Equal(t, "order was filled", result.Reason)
+	})
+
+	t.Run("NotOpen", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		resp, err := p.MarketBuy("BTC_RUB", "1")
+		require.NoError(t, err)
+		id, _ := orderIdOf(resp)
+
+		result, err := NewOrderAmender(p, market).Amend(context.Background(), id, 1, "900000")
+		require.NoError(t, err)
+		require.False(t, result.Replaced)
+		require.Equal(t, 1.0, result.Filled)
+		require.Equal(t, "order is not open", result.Reason)
+	})
+}
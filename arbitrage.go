@@ -0,0 +1,246 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// arbitrageBookDepth is the order book depth requested by the scanner, the minimum allowed by the API.
+const arbitrageBookDepth = 100
+
+// ArbitrageOpportunity is a profitable cycle of three market orders starting and ending in the same currency.
+type ArbitrageOpportunity struct {
+	Start         string
+	Path          ConversionPath // orders of the cycle sized to the volume available at the top of the books
+	Profit        float64        // Path.AmountOut - Path.AmountIn in the start currency
+	ProfitPercent float64
+	Found         time.Time
+}
+
+// ArbitrageScanner evaluates all currency triangles of the exchange pairs on top-of-book prices
+// and reports cycles profitable after taker commissions. It only reads public data and never places orders.
+type ArbitrageScanner struct {
+	market   MarketData
+	settings map[string]PairSettings
+
+	// Interval is the pause between scans in Run, 1 second by default.
+	Interval time.Duration
+	// MinProfitPercent filters out opportunities with lower net profit.
+	MinProfitPercent float64
+	// StartCurrencies limits scanning to triangles containing these currencies and starts cycles from them.
+	// If empty, every triangle starts from its alphabetically first currency.
+	StartCurrencies []string
+	// MaxAmount caps the amount of start currency put into a cycle.
+	MaxAmount map[string]float64
+	// OnError, if set, is called by Run with the error of a failed scan. Run keeps scanning anyway.
+	OnError func(err error)
+}
+
+// NewArbitrageScanner creates scanner reading the market data.
+func NewArbitrageScanner(market MarketData) *ArbitrageScanner {
+	return &ArbitrageScanner{market: market, Interval: time.Second}
+}
+
+// Run scans the market every Interval and sends found opportunities to the channel until the context is done.
+// A failed scan (e.g. on network or rate limit error) is reported to OnError and retried after Interval.
+// The channel is not closed.
+func (s *ArbitrageScanner) Run(ctx context.Context, opportunities chan<- ArbitrageOpportunity) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		found, err := s.Scan()
+		if err != nil && s.OnError != nil {
+			s.OnError(err)
+		}
+		for _, o := range found {
+			select {
+			case opportunities <- o:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		timer.Reset(interval)
+	}
+}
+
+// Scan fetches order books of all triangle pairs once and returns opportunities ordered by profit, the biggest first.
+func (s *ArbitrageScanner) Scan() ([]ArbitrageOpportunity, error) {
+	if s.settings == nil {
+		resp, err := s.market.GetPairSettings()
+		if err != nil {
+			return nil, err
+		}
+		if s.settings, err = ParsePairSettings(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	g := NewConversionGraph(s.settings, nil)
+	cycles := s.triangles(g)
+	var pairs []string
+	seen := map[string]bool{}
+	for _, c := range cycles {
+		for _, pair := range c.route {
+			if !seen[pair] {
+				seen[pair] = true
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	sort.Strings(pairs)
+
+	var err error
+	if g.books, err = fetchOrderBooks(s.market, pairs, arbitrageBookDepth); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var found []ArbitrageOpportunity
+	for _, c := range cycles {
+		if o, ok := s.evaluate(g, c.start, c.route); ok {
+			o.Found = now
+			found = append(found, o)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].ProfitPercent > found[j].ProfitPercent })
+	return found, nil
+}
+
+type arbitrageCycle struct {
+	start string
+	route []string
+}
+
+// triangles returns directed cycles of three pairs, each one once.
+func (s *ArbitrageScanner) triangles(g *ConversionGraph) []arbitrageCycle {
+	currencies := make([]string, 0, len(g.edges))
+	for currency := range g.edges {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	rank := map[string]int{}
+	for i, currency := range s.StartCurrencies {
+		if _, ok := rank[currency]; !ok {
+			rank[currency] = i
+		}
+	}
+	// startOf picks the currency the cycle is reported from, false if the cycle is out of scope
+	startOf := func(cycle []string) (string, bool) {
+		if len(rank) == 0 {
+			sorted := append([]string(nil), cycle...)
+			sort.Strings(sorted)
+			return sorted[0], true
+		}
+		start, best := "", len(rank)
+		for _, currency := range cycle {
+			if r, ok := rank[currency]; ok && r < best {
+				start, best = currency, r
+			}
+		}
+		return start, start != ""
+	}
+
+	var cycles []arbitrageCycle
+	for _, a := range currencies {
+		for _, e1 := range g.edges[a] {
+			for _, e2 := range g.edges[e1.to] {
+				if e2.to == a || e2.pair == e1.pair {
+					continue
+				}
+				for _, e3 := range g.edges[e2.to] {
+					if e3.to != a || e3.pair == e2.pair {
+						continue
+					}
+					if start, ok := startOf([]string{a, e1.to, e2.to}); ok && start == a {
+						cycles = append(cycles, arbitrageCycle{start: a, route: []string{e1.pair, e2.pair, e3.pair}})
+					}
+				}
+			}
+		}
+	}
+	return cycles
+}
+
+// evaluate checks profitability of the cycle at the top of the books and sizes it to the top levels volume.
+func (s *ArbitrageScanner) evaluate(g *ConversionGraph, start string, route []string) (ArbitrageOpportunity, bool) {
+	// factor is the amount received per unit of start currency before the current step
+	factor := 1.0
+	capacity := math.Inf(1)
+	currency := start
+	for _, pair := range route {
+		book := g.books[pair]
+		fee := 1 - g.settings[pair].CommissionTakerPercent/100
+		base, quote, _ := SplitPair(pair)
+
+		var limit, rate float64
+		switch {
+		case currency == base && len(book.Bid) > 0:
+			limit, rate = book.Bid[0].Quantity, book.Bid[0].Price
+			currency = quote
+		case currency == quote && len(book.Ask) > 0:
+			limit, rate = book.Ask[0].Quantity*book.Ask[0].Price, 1/book.Ask[0].Price
+			currency = base
+		default:
+			return ArbitrageOpportunity{}, false
+		}
+		capacity = math.Min(capacity, limit/factor)
+		factor *= rate * fee
+	}
+	if (factor-1)*100 <= s.MinProfitPercent {
+		return ArbitrageOpportunity{}, false
+	}
+	if max := s.MaxAmount[start]; max > 0 {
+		capacity = math.Min(capacity, max)
+	}
+
+	path, err := g.Simulate(start, capacity, route)
+	if err != nil {
+		return ArbitrageOpportunity{}, false
+	}
+	o := ArbitrageOpportunity{Start: start, Path: path, Profit: path.AmountOut - path.AmountIn}
+	o.ProfitPercent = o.Profit / path.AmountIn * 100
+	if o.Profit <= 0 || o.ProfitPercent <= s.MinProfitPercent {
+		return ArbitrageOpportunity{}, false
+	}
+	return o, true
+}
+
+// String describes the opportunity, e.g. "RUB->BTC->ETH->RUB +1.23%".
+func (o ArbitrageOpportunity) String() string {
+	currencies := []string{o.Start}
+	for _, step := range o.Path.Steps {
+		currencies = append(currencies, step.To)
+	}
+	return strings.Join(currencies, "->") + " +" + formatFloat(math.Round(o.ProfitPercent*100)/100) + "%"
+}
@@ -0,0 +1,119 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyMarket fails order book requests the number of times set.
+type flakyMarket struct {
+	*stubMarket
+	failures int
+}
+
+func (m *flakyMarket) GetOrderBook(pair string, limit int) (ApiResponse, error) {
+	if m.failures > 0 {
+		m.failures--
+		return nil, errors.New("Error 40016: rate limit exceeded")
+	}
+	return m.stubMarket.GetOrderBook(pair, limit)
+}
+
+func TestArbitrageScanner(t *testing.T) {
+	t.Run("NoOpportunity", func(t *testing.T) {
+		found, err := NewArbitrageScanner(newStubMarket()).Scan()
+		require.NoError(t, err)
+		require.Empty(t, found)
+	})
+
+	// ETH is bought for BTC at 0.02 (20000 RUB) and sold for 21000 RUB
+	market := newStubMarket()
+	market.books["ETH_RUB"] = `{"ask":[["21100","10","211000"]],"bid":[["21000","10","210000"]]}`
+	gross := 21000.0 / 20000 * 0.996 * 0.996 * 0.996
+
+	t.Run("Scan", func(t *testing.T) {
+		found, err := NewArbitrageScanner(market).Scan()
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+
+		o := found[0]
+		require.Equal(t, "BTC", o.Start)
+		require.Equal(t, []string{"ETH_BTC", "ETH_RUB", "BTC_RUB"}, o.Path.Pairs())
+		require.Equal(t, []string{"market_buy_total", "market_sell", "market_buy_total"},
+			[]string{o.Path.Steps[0].TypeOrder, o.Path.Steps[1].TypeOrder, o.Path.Steps[2].TypeOrder})
+		// limited by 10 ETH at the top of ETH_BTC asks
+		require.InDelta(t, 0.2, o.Path.AmountIn, 1e-8)
+		require.InDelta(t, (gross-1)*100, o.ProfitPercent, 1e-3)
+		require.Equal(t, "BTC->ETH->RUB->BTC +3.75%", o.String())
+	})
+
+	t.Run("StartCurrency", func(t *testing.T) {
+		s := NewArbitrageScanner(market)
+		s.StartCurrencies = []string{"RUB"}
+		s.MaxAmount = map[string]float64{"RUB": 100000}
+		found, err := s.Scan()
+		require.NoError(t, err)
+		require.Len(t, found, 1)
+		require.Equal(t, []string{"BTC_RUB", "ETH_BTC", "ETH_RUB"}, found[0].Path.Pairs())
+		require.Equal(t, 100000.0, found[0].Path.AmountIn)
+		require.InDelta(t, 100000*(gross-1), found[0].Profit, 1)
+
+		s.MinProfitPercent = 5
+		found, err = s.Scan()
+		require.NoError(t, err)
+		require.Empty(t, found)
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		s := NewArbitrageScanner(market)
+		s.Interval = time.Millisecond
+		ctx, cancel := context.WithCancel(context.Background())
+		opportunities := make(chan ArbitrageOpportunity)
+		done := make(chan error)
+		go func() { done <- s.Run(ctx, opportunities) }()
+
+		for i := 0; i < 2; i++ {
+			o := <-opportunities
+			require.Equal(t, "BTC", o.Start)
+		}
+		cancel()
+		require.Equal(t, context.Canceled, <-done)
+	})
+
+	t.Run("RunAfterErrors", func(t *testing.T) {
+		s := NewArbitrageScanner(&flakyMarket{stubMarket: market, failures: 2})
+		s.Interval = time.Millisecond
+		var failed []error
+		s.OnError = func(err error) { failed = append(failed, err) }
+		ctx, cancel := context.WithCancel(context.Background())
+		opportunities := make(chan ArbitrageOpportunity)
+		done := make(chan error)
+		go func() { done <- s.Run(ctx, opportunities) }()
+
+		o := <-opportunities
+		require.Equal(t, "BTC", o.Start)
+		require.Len(t, failed, 2)
+		cancel()
+		require.Equal(t, context.Canceled, <-done)
+	})
+}
@@ -0,0 +1,215 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultCancelConcurrency is the number of cancel requests sent in parallel by CancelOrders.
+// The client's rate limiter still applies to each of them.
+const DefaultCancelConcurrency = 4
+
+// OpenOrder is a user's order resting in the book.
+type OpenOrder struct {
+	OrderId  string
+	ClientId int64 // client order id, 0 if the order was created without it
+	Pair     string
+	Type     string // buy or sell
+	Price    float64
+	Quantity float64
+	Amount   float64
+	Created  time.Time
+}
+
+// ParseOpenOrders converts GetUserOpenOrders response (orders grouped by pair) to typed orders ordered by id.
+func ParseOpenOrders(resp ApiResponse) ([]OpenOrder, error) {
+	var orders []OpenOrder
+	for pair, value := range resp {
+		list, ok := value.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			fields, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("open orders for %s: unexpected format", pair)
+			}
+
+			o := OpenOrder{Pair: pair}
+			var err error
+			var created, clientId float64
+			for key, dst := range map[string]*float64{
+				"price":     &o.Price,
+				"quantity":  &o.Quantity,
+				"amount":    &o.Amount,
+				"created":   &created,
+				"client_id": &clientId,
+			} {
+				if v, ok := fields[key]; ok && v != nil {
+					if *dst, err = toFloat(v); err != nil {
+						return nil, fmt.Errorf("open orders for %s: %s: %s", pair, key, err)
+					}
+				}
+			}
+			o.Created = time.Unix(int64(created), 0).UTC()
+			o.ClientId = int64(clientId)
+			o.Type, _ = fields["type"].(string)
+			switch id := fields["order_id"].(type) {
+			case string:
+				o.OrderId = id
+			case float64:
+				o.OrderId = strconv.FormatInt(int64(id), 10)
+			default:
+				return nil, fmt.Errorf("open orders for %s: order_id: unexpected format", pair)
+			}
+			orders = append(orders, o)
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool { return lessOrderId(orders[i].OrderId, orders[j].OrderId) })
+	return orders, nil
+}
+
+// OrderFilter selects open orders, e.g. for CancelOrders.
+type OrderFilter func(o OpenOrder) bool
+
+// PairFilter selects orders of the pairs.
+func PairFilter(pairs ...string) OrderFilter {
+	set := map[string]bool{}
+	for _, pair := range pairs {
+		set[pair] = true
+	}
+	return func(o OpenOrder) bool { return set[o.Pair] }
+}
+
+// SideFilter selects buy or sell orders.
+func SideFilter(side string) OrderFilter {
+	return func(o OpenOrder) bool { return o.Type == side }
+}
+
+// OlderThanFilter selects orders created more than the duration ago, counting from the moment of filtering.
+func OlderThanFilter(age time.Duration) OrderFilter {
+	return func(o OpenOrder) bool { return time.Since(o.Created) > age }
+}
+
+// AllOf selects orders matching all the filters.
+func AllOf(filters ...OrderFilter) OrderFilter {
+	return func(o OpenOrder) bool {
+		for _, filter := range filters {
+			if !filter(o) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// CancelResult is the outcome of cancelling a single order.
+type CancelResult struct {
+	Order OpenOrder
+	Err   error // nil if cancelled
+}
+
+// CancelReport lists cancelled and failed orders in order of ids.
+type CancelReport struct {
+	Results   []CancelResult
+	Cancelled int
+	Failed    int
+}
+
+// Errors returns results of orders that were not cancelled.
+func (r CancelReport) Errors() []CancelResult {
+	var failed []CancelResult
+	for _, result := range r.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// CancelOrders cancels open orders selected by the filter (all orders if nil) sending up to concurrency
+// requests in parallel (DefaultCancelConcurrency if zero). Orders that were not cancelled, e.g. filled meanwhile
+// or skipped because the context is done, are reported with the error. The error is returned only
+// if open orders can't be listed.
+func CancelOrders(ctx context.Context, trader Trader, filter OrderFilter, concurrency int) (CancelReport, error) {
+	resp, err := trader.GetUserOpenOrders()
+	if err != nil {
+		return CancelReport{}, err
+	}
+	orders, err := ParseOpenOrders(resp)
+	if err != nil {
+		return CancelReport{}, err
+	}
+
+	var report CancelReport
+	for _, o := range orders {
+		if filter == nil || filter(o) {
+			report.Results = append(report.Results, CancelResult{Order: o})
+		}
+	}
+
+	if concurrency <= 0 {
+		concurrency = DefaultCancelConcurrency
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(report.Results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := &report.Results[i]
+				if result.Err = ctx.Err(); result.Err != nil {
+					continue
+				}
+				_, result.Err = trader.OrderCancel(result.Order.OrderId)
+			}
+		}()
+	}
+	for i := range report.Results {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Err != nil {
+			report.Failed++
+		} else {
+			report.Cancelled++
+		}
+	}
+	return report, nil
+}
+
+// CancelOrders cancels open orders selected by the filter (all orders if nil), see CancelOrders function.
+// Requests go through the client's rate limiter.
+func (ex *Exmo) CancelOrders(ctx context.Context, filter OrderFilter) (CancelReport, error) {
+	return CancelOrders(ctx, ex, filter, DefaultCancelConcurrency)
+}
+
+// CancelAllOrders cancels all open orders.
+func (ex *Exmo) CancelAllOrders(ctx context.Context) (CancelReport, error) {
+	return CancelOrders(ctx, ex, nil, DefaultCancelConcurrency)
+}
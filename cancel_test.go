@@ -0,0 +1,114 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancelOrders(t *testing.T) {
+	t.Run("Filters", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 10000000, "BTC": 10, "ETH": 100})
+		now := time.Now()
+		p.now = func() time.Time { return now.Add(-2 * time.Hour) }
+		_, err := p.Buy("BTC_RUB", "1", "900000") // 1
+		require.NoError(t, err)
+		p.now = func() time.Time { return now }
+		_, err = p.Sell("BTC_RUB", "1", "1100000") // 2
+		require.NoError(t, err)
+		_, err = p.Buy("ETH_RUB", "1", "19000") // 3
+		require.NoError(t, err)
+		_, err = p.Sell("ETH_BTC", "1", "0.03") // 4
+		require.NoError(t, err)
+
+		report, err := CancelOrders(context.Background(), p, AllOf(PairFilter("BTC_RUB"), SideFilter("sell")), 0)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Cancelled)
+		require.Equal(t, "2", report.Results[0].Order.OrderId)
+
+		report, err = CancelOrders(context.Background(), p, OlderThanFilter(time.Hour), 0)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Cancelled)
+		require.Equal(t, "1", report.Results[0].Order.OrderId)
+
+		report, err = CancelOrders(context.Background(), p, nil, 0)
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Cancelled)
+		require.Equal(t, "3", report.Results[0].Order.OrderId)
+		require.Equal(t, "4", report.Results[1].Order.OrderId)
+
+		open, _ := p.GetUserOpenOrders()
+		require.Empty(t, open)
+		require.InDelta(t, 10000000, paperBalance(t, p, "balances", "RUB"), 1e-6)
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		var mu sync.Mutex
+		var cancelled []string
+		api := stubApi(func(method string, params url.Values) string {
+			switch method {
+			case "user_open_orders":
+				return `{"BTC_RUB":[
+					{"order_id":"10","created":"1570000000","type":"buy","pair":"BTC_RUB","price":"900000","quantity":"1","amount":"900000"},
+					{"order_id":"11","created":"1570000000","type":"buy","pair":"BTC_RUB","price":"900000","quantity":"1","amount":"900000"}],
+					"ETH_RUB":[{"order_id":"9","created":"1570000000","type":"sell","pair":"ETH_RUB","price":"30000","quantity":"1","amount":"30000"}]}`
+			case "order_cancel":
+				if params.Get("order_id") == "11" {
+					return `{"result":false,"error":"Error 50304: Order was not found"}`
+				}
+				mu.Lock()
+				cancelled = append(cancelled, params.Get("order_id"))
+				mu.Unlock()
+				return `{"result":true,"error":""}`
+			}
+			return `{}`
+		}, WithRateLimit(1000))
+
+		report, err := api.CancelAllOrders(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 2, report.Cancelled)
+		require.Equal(t, 1, report.Failed)
+		require.Equal(t, []string{"9", "10", "11"}, []string{
+			report.Results[0].Order.OrderId, report.Results[1].Order.OrderId, report.Results[2].Order.OrderId,
+		})
+		require.Len(t, report.Errors(), 1)
+		require.Equal(t, "11", report.Errors()[0].Order.OrderId)
+
+		sort.Strings(cancelled)
+		require.Equal(t, []string{"10", "9"}, cancelled)
+	})
+
+	t.Run("ContextDone", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 10000000})
+		_, err := p.Buy("BTC_RUB", "1", "900000")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		report, err := CancelOrders(ctx, p, nil, 0)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Failed)
+		require.Equal(t, context.Canceled, report.Results[0].Err)
+	})
+}
@@ -0,0 +1,142 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithClientOrderIds makes OrderCreate (and all methods built on it) tag every order with a generated
+// client order id. The id is returned in "client_id" field of the response, or in *ClientOrderError
+// if the request failed.
+func WithClientOrderIds() Option {
+	return func(ex *Exmo) {
+		ex.clientIds = true
+	}
+}
+
+// ClientOrderError is returned when the request creating an order tagged with client order id failed.
+// The order may have been created anyway (e.g. the response was lost on timeout), so check it with
+// FindOrderByClientId before retrying with the same id.
+type ClientOrderError struct {
+	ClientId int64
+	Err      error
+}
+
+func (e *ClientOrderError) Error() string {
+	return fmt.Sprintf("order with client id %d: %s", e.ClientId, e.Err)
+}
+
+var clientIds struct {
+	sync.Mutex
+	last int64
+}
+
+// NewClientId generates unique increasing client order id based on the current time in microseconds.
+// Ids stay below 2^53, so they survive decoding of JSON numbers into float64.
+func NewClientId() int64 {
+	clientIds.Lock()
+	defer clientIds.Unlock()
+
+	id := time.Now().UnixNano() / int64(time.Microsecond)
+	if id <= clientIds.last {
+		id = clientIds.last + 1
+	}
+	clientIds.last = id
+	return id
+}
+
+// ClientOrder is an order found by client order id.
+type ClientOrder struct {
+	ClientId int64
+	OrderId  string
+	Pair     string
+	Open     bool        // the order rests in the book
+	Order    OpenOrder   // the order as listed in open orders, if open
+	Trades   []UserTrade // trades of the order among the latest trades of the pair
+}
+
+// FindOrderByClientId looks for the order with the client order id among open orders and the latest
+// 1000 trades of the pair. Use it to find out whether an order was created when OrderCreateWithClientId
+// failed without a response (e.g. on timeout) before retrying it with the same id.
+func (ex *Exmo) FindOrderByClientId(pair string, clientId int64) (ClientOrder, bool, error) {
+	found := ClientOrder{ClientId: clientId, Pair: pair}
+
+	resp, err := ex.GetUserOpenOrders()
+	if err != nil {
+		return found, false, err
+	}
+	orders, err := ParseOpenOrders(resp)
+	if err != nil {
+		return found, false, err
+	}
+	for _, o := range orders {
+		if o.ClientId == clientId && o.Pair == pair {
+			found.Open, found.Order, found.OrderId = true, o, o.OrderId
+			break
+		}
+	}
+
+	trades, err := ex.userTradesPage(context.Background(), pair, 0, maxUserTradesLimit)
+	if err != nil {
+		return found, false, err
+	}
+	for _, t := range trades {
+		if t.ClientId == clientId {
+			found.Trades = append(found.Trades, t)
+			if found.OrderId == "" {
+				found.OrderId = strconv.FormatInt(t.OrderId, 10)
+			}
+		}
+	}
+
+	return found, found.OrderId != "", nil
+}
+
+// BuyWithClientId creates buy order tagged with client order id
+func (ex *Exmo) BuyWithClientId(pair string, quantity string, price string, clientId int64) (ApiResponse, error) {
+	return ex.OrderCreateWithClientId(pair, quantity, price, "buy", clientId)
+}
+
+// SellWithClientId creates sell order tagged with client order id
+func (ex *Exmo) SellWithClientId(pair string, quantity string, price string, clientId int64) (ApiResponse, error) {
+	return ex.OrderCreateWithClientId(pair, quantity, price, "sell", clientId)
+}
+
+// MarketBuyWithClientId creates market buy-order tagged with client order id
+func (ex *Exmo) MarketBuyWithClientId(pair string, quantity string, clientId int64) (ApiResponse, error) {
+	return ex.OrderCreateWithClientId(pair, quantity, "0", "market_buy", clientId)
+}
+
+// MarketBuyTotalWithClientId creates market buy-order for a certain amount (quantity parameter) tagged with client order id
+func (ex *Exmo) MarketBuyTotalWithClientId(pair string, quantity string, clientId int64) (ApiResponse, error) {
+	return ex.OrderCreateWithClientId(pair, quantity, "0", "market_buy_total", clientId)
+}
+
+// MarketSellWithClientId creates market sell-order tagged with client order id
+func (ex *Exmo) MarketSellWithClientId(pair string, quantity string, clientId int64) (ApiResponse, error) {
+	return ex.OrderCreateWithClientId(pair, quantity, "0", "market_sell", clientId)
+}
+
+// MarketSellTotalWithClientId creates market sell-order for a certain amount (quantity parameter) tagged with client order id
+func (ex *Exmo) MarketSellTotalWithClientId(pair string, quantity string, clientId int64) (ApiResponse, error) {
+	return ex.OrderCreateWithClientId(pair, quantity, "0", "market_sell_total", clientId)
+}
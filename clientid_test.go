@@ -0,0 +1,135 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOrderIds(t *testing.T) {
+	t.Run("Generate", func(t *testing.T) {
+		last := NewClientId()
+		for i := 0; i < 1000; i++ {
+			id := NewClientId()
+			require.True(t, id > last)
+			require.True(t, id < 1<<53)
+			last = id
+		}
+	})
+
+	t.Run("AutoTag", func(t *testing.T) {
+		var sent []string
+		api := stubApi(func(method string, params url.Values) string {
+			sent = append(sent, params.Get("client_id"))
+			return `{"result":true,"error":"","order_id":123}`
+		}, WithClientOrderIds())
+
+		resp, err := api.Buy("BTC_RUB", "1", "900000")
+		require.NoError(t, err)
+		require.Len(t, sent, 1)
+		require.NotEmpty(t, sent[0])
+		require.Equal(t, sent[0], formatFloat(resp["client_id"].(float64)))
+
+		plain := stubApi(func(method string, params url.Values) string {
+			sent = append(sent, params.Get("client_id"))
+			return `{"result":true,"error":"","order_id":124}`
+		})
+		resp, err = plain.Buy("BTC_RUB", "1", "900000")
+		require.NoError(t, err)
+		require.Equal(t, "", sent[1])
+		require.NotContains(t, resp, "client_id")
+	})
+
+	t.Run("LostResponse", func(t *testing.T) {
+		var sent []string
+		api := stubApi(func(method string, params url.Values) string {
+			sent = append(sent, params.Get("client_id"))
+			return `{"result":false,"error":"Error 40017: timeout"}`
+		}, WithClientOrderIds())
+
+		// the generated id comes with the error, so the order can be looked up before a retry
+		_, err := api.MarketBuy("BTC_RUB", "1")
+		clientErr, ok := err.(*ClientOrderError)
+		require.True(t, ok, "unexpected error %v", err)
+		require.Equal(t, sent[0], strconv.FormatInt(clientErr.ClientId, 10))
+		require.Contains(t, err.Error(), "timeout")
+
+		// the caller can also generate the id first
+		id := NewClientId()
+		_, err = api.SellWithClientId("BTC_RUB", "1", "1000000", id)
+		require.Equal(t, id, err.(*ClientOrderError).ClientId)
+		require.Equal(t, strconv.FormatInt(id, 10), sent[1])
+	})
+
+	t.Run("Paper", func(t *testing.T) {
+		var trader Trader = NewPaper(newStubMarket(), map[string]float64{"RUB": 2000000})
+		resp, err := trader.OrderCreateWithClientId("BTC_RUB", "1", "900000", "buy", 77)
+		require.NoError(t, err)
+		require.Equal(t, float64(77), resp["client_id"])
+		_, err = trader.OrderCreateWithClientId("BTC_RUB", "0.1", "1000000", "buy", 78)
+		require.NoError(t, err)
+
+		open, _ := trader.GetUserOpenOrders()
+		orders, err := ParseOpenOrders(open)
+		require.NoError(t, err)
+		require.Len(t, orders, 1)
+		require.Equal(t, int64(77), orders[0].ClientId)
+
+		trades, err := fetchOrderTrades(trader, "2")
+		require.NoError(t, err)
+		require.Equal(t, int64(78), trades[0].ClientId)
+	})
+
+	t.Run("Find", func(t *testing.T) {
+		api := stubApi(func(method string, params url.Values) string {
+			switch method {
+			case "user_open_orders":
+				return `{"BTC_RUB":[{"order_id":"15","client_id":"77","created":"1570000000","type":"buy","pair":"BTC_RUB","price":"900000","quantity":"1","amount":"900000"}]}`
+			case "user_trades":
+				return `{"BTC_RUB":[
+					{"trade_id":3,"client_id":0,"date":1570000002,"type":"sell","pair":"BTC_RUB","order_id":16,"quantity":"1","price":"1000000","amount":"1000000"},
+					{"trade_id":2,"client_id":78,"date":1570000001,"type":"sell","pair":"BTC_RUB","order_id":14,"quantity":"1","price":"1000000","amount":"1000000"},
+					{"trade_id":1,"client_id":77,"date":1570000000,"type":"buy","pair":"BTC_RUB","order_id":15,"quantity":"0.5","price":"900000","amount":"450000"}]}`
+			}
+			return `{}`
+		})
+
+		// partially filled order is both open and traded
+		order, ok, err := api.FindOrderByClientId("BTC_RUB", 77)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.True(t, order.Open)
+		require.Equal(t, "15", order.OrderId)
+		require.Len(t, order.Trades, 1)
+
+		// filled order is found by its trades
+		order, ok, err = api.FindOrderByClientId("BTC_RUB", 78)
+		require.NoError(t, err)
+		require.True(t, ok)
+		require.False(t, order.Open)
+		require.Equal(t, "14", order.OrderId)
+
+		// the order was never created, it is safe to retry
+		_, ok, err = api.FindOrderByClientId("BTC_RUB", 79)
+		require.NoError(t, err)
+		require.False(t, ok)
+	})
+}
@@ -0,0 +1,124 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vadiminshakov/exmo"
+)
+
+func runExport(api *exmo.Exmo, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	data := flags.String("data", "trades", "what to export: trades, cancelled or wallet")
+	format := flags.String("format", "csv", "output format: csv or jsonl")
+	pairs := flags.String("pairs", "", "comma-separated currency pairs of trades, e.g. BTC_RUB,ETH_RUB")
+	from := flags.String("from", "", "start date (YYYY-MM-DD, UTC), required for wallet history")
+	to := flags.String("to", "", "end date inclusive (YYYY-MM-DD, UTC), today by default")
+	out := flags.String("out", "", "output file, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	storeFormat := exmo.StoreFormat(*format)
+	if storeFormat != exmo.FormatCSV && storeFormat != exmo.FormatJSONLines {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var begin, end time.Time
+	var err error
+	if *from != "" {
+		if begin, err = time.Parse("2006-01-02", *from); err != nil {
+			return fmt.Errorf("invalid -from: %s", err)
+		}
+	}
+	end = time.Now().UTC()
+	if *to != "" {
+		if end, err = time.Parse("2006-01-02", *to); err != nil {
+			return fmt.Errorf("invalid -to: %s", err)
+		}
+		end = end.Add(24*time.Hour - time.Second)
+	}
+	inRange := func(t time.Time) bool {
+		return !t.Before(begin) && !t.After(end)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx := context.Background()
+	switch *data {
+	case "trades":
+		if *pairs == "" {
+			return errors.New("-pairs is required for trades")
+		}
+		var trades []exmo.UserTrade
+		it := api.IterateUserTrades(ctx, strings.Split(*pairs, ","), 1000)
+		for it.Next() {
+			if inRange(it.Trade().Date) {
+				trades = append(trades, it.Trade())
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		sort.Slice(trades, func(i, j int) bool { return trades[i].TradeId < trades[j].TradeId })
+		return exmo.ExportTrades(w, storeFormat, trades)
+	case "cancelled":
+		all, err := api.AllCancelledOrders()
+		if err != nil {
+			return err
+		}
+		var orders []exmo.CancelledOrder
+		for _, o := range all {
+			if inRange(o.Date) {
+				orders = append(orders, o)
+			}
+		}
+		return exmo.ExportCancelledOrders(w, storeFormat, orders)
+	case "wallet":
+		if begin.IsZero() {
+			return errors.New("-from is required for wallet history")
+		}
+		var operations []exmo.WalletOperation
+		it := api.IterateWalletHistory(ctx, begin, end)
+		for it.Next() {
+			operations = append(operations, it.Operation())
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+		return exmo.ExportWalletHistory(w, storeFormat, operations)
+	default:
+		return fmt.Errorf("unknown data %q", *data)
+	}
+}
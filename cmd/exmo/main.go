@@ -0,0 +1,67 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Command exmo is a command line tool for EXMO account.
+//
+// Credentials are taken from EXMO_PUBLIC and EXMO_SECRET environment variables.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/vadiminshakov/exmo"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(api *exmo.Exmo, args []string) error
+}
+
+var commands = []command{
+	{"export", "export trades, cancelled orders or wallet history as CSV or JSON Lines", runExport},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: exmo <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nrun 'exmo <command> -h' for command flags")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	api := exmo.Api(os.Getenv("EXMO_PUBLIC"), os.Getenv("EXMO_SECRET"))
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(&api, os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "exmo %s: %s\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	usage()
+	os.Exit(2)
+}
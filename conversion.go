@@ -0,0 +1,269 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultConversionHops is the maximal number of orders in a conversion path used when zero is passed.
+const DefaultConversionHops = 3
+
+// orderBookBatch is the number of pairs requested in a single order_book call.
+const orderBookBatch = 50
+
+// ConversionStep is a single market order of a conversion path.
+type ConversionStep struct {
+	Pair      string
+	From      string
+	To        string
+	TypeOrder string // market_sell if From is the base currency, market_buy_total if it is the quote one
+	Quantity  string // quantity param of OrderCreate: base quantity to sell or quote amount to spend
+	AmountIn  float64
+	AmountOut float64 // received after taker commission
+	Estimate  ExecutionEstimate
+}
+
+// ConversionPath is a sequence of orders converting one currency into another.
+type ConversionPath struct {
+	From      string
+	To        string
+	AmountIn  float64
+	AmountOut float64
+	Rate      float64 // AmountOut / AmountIn
+	Steps     []ConversionStep
+}
+
+// Pairs returns pairs of the path in order of execution.
+func (p ConversionPath) Pairs() []string {
+	pairs := make([]string, len(p.Steps))
+	for i, step := range p.Steps {
+		pairs[i] = step.Pair
+	}
+	return pairs
+}
+
+// conversionEdge is a pair that converts currency into the other one.
+type conversionEdge struct {
+	pair string
+	to   string
+	sell bool // the currency is the base one and is sold
+}
+
+// ConversionGraph connects currencies by trading pairs and simulates conversions with market orders
+// against order book snapshots.
+type ConversionGraph struct {
+	settings map[string]PairSettings
+	books    map[string]OrderBook
+	edges    map[string][]conversionEdge
+}
+
+// NewConversionGraph creates graph of the pairs having settings. Books are required for pairs used in simulation.
+func NewConversionGraph(settings map[string]PairSettings, books map[string]OrderBook) *ConversionGraph {
+	g := &ConversionGraph{settings: settings, books: books, edges: map[string][]conversionEdge{}}
+
+	pairs := make([]string, 0, len(settings))
+	for pair := range settings {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for _, pair := range pairs {
+		base, quote, err := SplitPair(pair)
+		if err != nil {
+			continue
+		}
+		g.edges[base] = append(g.edges[base], conversionEdge{pair: pair, to: quote, sell: true})
+		g.edges[quote] = append(g.edges[quote], conversionEdge{pair: pair, to: base})
+	}
+	return g
+}
+
+// Routes returns all paths (as lists of pairs) from one currency to another with at most maxHops pairs,
+// shorter paths first. Currencies are not visited twice.
+func (g *ConversionGraph) Routes(from, to string, maxHops int) [][]string {
+	if maxHops <= 0 {
+		maxHops = DefaultConversionHops
+	}
+
+	var routes [][]string
+	visited := map[string]bool{from: true}
+	var route []string
+	var walk func(currency string)
+	walk = func(currency string) {
+		for _, e := range g.edges[currency] {
+			if e.to == to {
+				routes = append(routes, append(append([]string(nil), route...), e.pair))
+				continue
+			}
+			if visited[e.to] || len(route)+1 >= maxHops {
+				continue
+			}
+			visited[e.to] = true
+			route = append(route, e.pair)
+			walk(e.to)
+			route = route[:len(route)-1]
+			visited[e.to] = false
+		}
+	}
+	if from != to {
+		walk(from)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i]) < len(routes[j]) })
+	return routes
+}
+
+// Simulate converts the amount along the route (list of pairs) with market orders: market_sell where
+// the held currency is the base one and market_buy_total where it is the quote one. Each order walks
+// the book, pays taker commission and must pass pair limits; the received amount sizes the next order.
+func (g *ConversionGraph) Simulate(from string, amount float64, route []string) (ConversionPath, error) {
+	path := ConversionPath{From: from, AmountIn: amount}
+	currency := from
+	for _, pair := range route {
+		base, quote, err := SplitPair(pair)
+		if err != nil {
+			return path, err
+		}
+		settings, ok := g.settings[pair]
+		if !ok {
+			return path, fmt.Errorf("unknown currency pair %s", pair)
+		}
+		book, ok := g.books[pair]
+		if !ok {
+			return path, fmt.Errorf("no order book for %s", pair)
+		}
+
+		step := ConversionStep{Pair: pair, From: currency}
+		switch currency {
+		case base:
+			step.To, step.TypeOrder = quote, "market_sell"
+		case quote:
+			step.To, step.TypeOrder = base, "market_buy_total"
+		default:
+			return path, fmt.Errorf("pair %s doesn't convert %s", pair, currency)
+		}
+
+		step.Quantity = settings.RoundQuantity(amount, RoundDown)
+		if step.Quantity, _, err = ValidateOrder(settings, pair, step.Quantity, "0", step.TypeOrder); err != nil {
+			return path, err
+		}
+		step.AmountIn, _ = strconv.ParseFloat(step.Quantity, 64)
+
+		if step.Estimate, err = EstimateExecution(book, settings, step.TypeOrder, step.AmountIn); err != nil {
+			return path, err
+		}
+		if !step.Estimate.Complete {
+			return path, fmt.Errorf("order book of %s is not deep enough for %s %s", pair, step.Quantity, currency)
+		}
+		step.AmountOut = step.Estimate.Net
+
+		path.Steps = append(path.Steps, step)
+		currency, amount = step.To, step.AmountOut
+	}
+
+	path.To, path.AmountOut = currency, amount
+	if path.AmountIn > 0 {
+		path.Rate = path.AmountOut / path.AmountIn
+	}
+	return path, nil
+}
+
+// BestPath simulates all routes with at most maxHops orders (DefaultConversionHops if zero) and returns
+// the one yielding the most of the target currency after fees and slippage.
+func (g *ConversionGraph) BestPath(from, to string, amount float64, maxHops int) (ConversionPath, error) {
+	routes := g.Routes(from, to, maxHops)
+	if len(routes) == 0 {
+		return ConversionPath{}, fmt.Errorf("no conversion path from %s to %s", from, to)
+	}
+
+	var best ConversionPath
+	var reasons []string
+	for _, route := range routes {
+		path, err := g.Simulate(from, amount, route)
+		if err != nil {
+			reasons = append(reasons, strings.Join(route, "->")+": "+err.Error())
+			continue
+		}
+		if best.Steps == nil || path.AmountOut > best.AmountOut {
+			best = path
+		}
+	}
+	if best.Steps == nil {
+		return best, fmt.Errorf("no executable conversion path from %s to %s: %s", from, to, strings.Join(reasons, "; "))
+	}
+	return best, nil
+}
+
+// BestConversionPath loads pair settings and order books of pairs on the routes from one currency to another
+// and finds the best path, see ConversionGraph.BestPath.
+func BestConversionPath(market MarketData, from, to string, amount float64, maxHops int) (ConversionPath, error) {
+	resp, err := market.GetPairSettings()
+	if err != nil {
+		return ConversionPath{}, err
+	}
+	settings, err := ParsePairSettings(resp)
+	if err != nil {
+		return ConversionPath{}, err
+	}
+
+	g := NewConversionGraph(settings, nil)
+	var pairs []string
+	seen := map[string]bool{}
+	for _, route := range g.Routes(from, to, maxHops) {
+		for _, pair := range route {
+			if !seen[pair] {
+				seen[pair] = true
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+	if g.books, err = fetchOrderBooks(market, pairs, 1000); err != nil {
+		return ConversionPath{}, err
+	}
+	return g.BestPath(from, to, amount, maxHops)
+}
+
+// BestConversionPath finds the cheapest way to convert the amount with market orders, see BestConversionPath function.
+func (ex *Exmo) BestConversionPath(from, to string, amount float64, maxHops int) (ConversionPath, error) {
+	return BestConversionPath(ex, from, to, amount, maxHops)
+}
+
+// fetchOrderBooks requests books of the pairs, several pairs per request.
+func fetchOrderBooks(market MarketData, pairs []string, limit int) (map[string]OrderBook, error) {
+	books := make(map[string]OrderBook, len(pairs))
+	for len(pairs) > 0 {
+		batch := pairs
+		if len(batch) > orderBookBatch {
+			batch = batch[:orderBookBatch]
+		}
+		pairs = pairs[len(batch):]
+
+		resp, err := market.GetOrderBook(strings.Join(batch, ","), limit)
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range batch {
+			if books[pair], err = ParseOrderBook(resp, pair); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return books, nil
+}
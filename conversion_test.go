@@ -0,0 +1,76 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversion(t *testing.T) {
+	t.Run("Routes", func(t *testing.T) {
+		settings, err := ParsePairSettings(decodeResponse(testPairSettings))
+		require.NoError(t, err)
+		g := NewConversionGraph(settings, nil)
+		require.Equal(t, [][]string{{"ETH_RUB"}, {"BTC_RUB", "ETH_BTC"}}, g.Routes("RUB", "ETH", 0))
+		require.Equal(t, [][]string{{"ETH_RUB"}}, g.Routes("RUB", "ETH", 1))
+		require.Empty(t, g.Routes("RUB", "USD", 0))
+	})
+
+	t.Run("Direct", func(t *testing.T) {
+		path, err := BestConversionPath(newStubMarket(), "RUB", "ETH", 100000, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ETH_RUB"}, path.Pairs())
+		require.Equal(t, "market_buy_total", path.Steps[0].TypeOrder)
+		require.Equal(t, "100000", path.Steps[0].Quantity)
+		require.InDelta(t, 5*0.996, path.AmountOut, 1e-9)
+	})
+
+	t.Run("MultiHop", func(t *testing.T) {
+		market := newStubMarket()
+		market.books["ETH_RUB"] = `{"ask":[["21000","10","210000"]],"bid":[["19900","10","199000"]]}`
+
+		path, err := BestConversionPath(market, "RUB", "ETH", 100000, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"BTC_RUB", "ETH_BTC"}, path.Pairs())
+		require.Equal(t, "BTC", path.Steps[0].To)
+		require.InDelta(t, 0.1*0.996, path.Steps[0].AmountOut, 1e-12)
+		require.Equal(t, "0.0996", path.Steps[1].Quantity)
+		require.InDelta(t, 0.0996/0.02*0.996, path.AmountOut, 1e-9)
+		require.InDelta(t, path.AmountOut/100000, path.Rate, 1e-15)
+
+		// selling goes through the bids
+		path, err = BestConversionPath(market, "ETH", "RUB", 1, 0)
+		require.NoError(t, err)
+		require.Equal(t, []string{"ETH_RUB"}, path.Pairs())
+		require.Equal(t, "market_sell", path.Steps[0].TypeOrder)
+		require.InDelta(t, 19900*0.996, path.AmountOut, 1e-9)
+	})
+
+	t.Run("Depth", func(t *testing.T) {
+		_, err := BestConversionPath(newStubMarket(), "RUB", "ETH", 500000, 0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "not deep enough")
+	})
+
+	t.Run("Limits", func(t *testing.T) {
+		_, err := BestConversionPath(newStubMarket(), "RUB", "ETH", 5, 0)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "min_amount")
+	})
+}
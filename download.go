@@ -0,0 +1,394 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StoreFormat is the format of files with trades.
+type StoreFormat string
+
+const (
+	// FormatJSONLines stores one JSON object per line.
+	FormatJSONLines StoreFormat = "jsonl"
+	// FormatCSV stores comma-separated values with a header line.
+	FormatCSV StoreFormat = "csv"
+)
+
+// TradeColumns is the stable column set of stored and exported trades.
+var TradeColumns = []string{
+	"trade_id", "date", "pair", "type", "order_id", "quantity", "price", "amount",
+	"exec_type", "commission_amount", "commission_currency", "commission_percent",
+}
+
+// tradeRow returns values of TradeColumns for the trade.
+func tradeRow(t UserTrade) []string {
+	return []string{
+		strconv.FormatInt(t.TradeId, 10),
+		t.Date.UTC().Format(time.RFC3339),
+		t.Pair,
+		t.Type,
+		strconv.FormatInt(t.OrderId, 10),
+		decimal(t.Raw, "quantity", t.Quantity),
+		decimal(t.Raw, "price", t.Price),
+		decimal(t.Raw, "amount", t.Amount),
+		t.ExecType,
+		decimal(t.Raw, "commission_amount", t.CommissionAmount),
+		t.CommissionCurrency,
+		decimal(t.Raw, "commission_percent", t.CommissionPercent),
+	}
+}
+
+// writeRows writes rows in the format: CSV records or JSON objects with string values keyed by columns in their order.
+func writeRows(w io.Writer, format StoreFormat, columns []string, rows [][]string) error {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	case FormatJSONLines:
+		var buf bytes.Buffer
+		for _, row := range rows {
+			buf.WriteByte('{')
+			for i, column := range columns {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				key, _ := json.Marshal(column)
+				value, _ := json.Marshal(row[i])
+				buf.Write(key)
+				buf.WriteByte(':')
+				buf.Write(value)
+			}
+			buf.WriteString("}\n")
+		}
+		_, err := w.Write(buf.Bytes())
+		return err
+	default:
+		return fmt.Errorf("unknown store format %q", format)
+	}
+}
+
+// tradeStore is an append-only file of trades of a single pair.
+type tradeStore struct {
+	path   string
+	format StoreFormat
+}
+
+// ids reads trade ids already stored. A torn last line left by a crash is cut off.
+func (s *tradeStore) ids() (map[int64]bool, error) {
+	ids := map[int64]bool{}
+
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return ids, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var good int64
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			if line != "" {
+				// the line was not completely written, drop it so that appends start on a clean line
+				return ids, os.Truncate(s.path, good)
+			}
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		good += int64(len(line))
+
+		id, ok, err := s.parseId(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", s.path, err)
+		}
+		if ok {
+			ids[id] = true
+		}
+	}
+}
+
+func (s *tradeStore) parseId(line string) (int64, bool, error) {
+	if line == "" {
+		return 0, false, nil
+	}
+	var value string
+	if s.format == FormatCSV {
+		record, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil {
+			return 0, false, err
+		}
+		if record[0] == TradeColumns[0] {
+			return 0, false, nil // header
+		}
+		value = record[0]
+	} else {
+		var record struct {
+			TradeId string `json:"trade_id"`
+		}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			return 0, false, err
+		}
+		value = record.TradeId
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	return id, err == nil, err
+}
+
+// append writes trades to the end of the file and flushes it to disk.
+func (s *tradeStore) append(trades []UserTrade) error {
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	rows := make([][]string, 0, len(trades)+1)
+	if s.format == FormatCSV {
+		if info, err := f.Stat(); err == nil && info.Size() == 0 {
+			rows = append(rows, TradeColumns)
+		}
+	}
+	for _, t := range trades {
+		rows = append(rows, tradeRow(t))
+	}
+	if err := writeRows(f, s.format, TradeColumns, rows); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// Checkpoint is the download progress of a pair. Trades of the pair come newest first, so the downloader
+// keeps the newest and the oldest stored trade ids and the offset reached in the last run.
+type Checkpoint struct {
+	Pair     string    `json:"pair"`
+	Newest   int64     `json:"newest_trade_id"`
+	Oldest   int64     `json:"oldest_trade_id"`
+	Offset   int       `json:"offset"`
+	Complete bool      `json:"complete"` // all trades older than Newest are stored
+	Updated  time.Time `json:"updated"`
+}
+
+// Downloader downloads all user trades of pairs into append-only files (one per pair) and keeps
+// a checkpoint file next to each of them, so an interrupted download resumes where it stopped.
+// Trades are deduplicated by trade id.
+type Downloader struct {
+	ex       *Exmo
+	dir      string
+	format   StoreFormat
+	PageSize int // user_trades page size, 1000 by default
+}
+
+// NewDownloader creates downloader storing files in the directory.
+func NewDownloader(ex *Exmo, dir string, format StoreFormat) *Downloader {
+	return &Downloader{ex: ex, dir: dir, format: format, PageSize: maxUserTradesLimit}
+}
+
+// Download fetches trades of the pairs missing in the store. Run it again after an error to resume,
+// or later to append trades made since the previous run.
+func (d *Downloader) Download(ctx context.Context, pairs ...string) error {
+	if d.format != FormatCSV && d.format != FormatJSONLines {
+		return fmt.Errorf("unknown store format %q", d.format)
+	}
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	for _, pair := range pairs {
+		if err := d.downloadPair(ctx, pair); err != nil {
+			return fmt.Errorf("download %s: %s", pair, err)
+		}
+	}
+	return nil
+}
+
+// Checkpoint returns the saved progress of the pair.
+func (d *Downloader) Checkpoint(pair string) (Checkpoint, error) {
+	cp := Checkpoint{Pair: pair}
+	data, err := ioutil.ReadFile(d.checkpointPath(pair))
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return cp, err
+	}
+	err = json.Unmarshal(data, &cp)
+	return cp, err
+}
+
+// StorePath returns path of the file with trades of the pair.
+func (d *Downloader) StorePath(pair string) string {
+	return filepath.Join(d.dir, pair+"."+string(d.format))
+}
+
+func (d *Downloader) checkpointPath(pair string) string {
+	return filepath.Join(d.dir, pair+".checkpoint.json")
+}
+
+// saveCheckpoint replaces checkpoint file atomically.
+func (d *Downloader) saveCheckpoint(cp Checkpoint) error {
+	cp.Updated = time.Now().UTC()
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(d.checkpointPath(cp.Pair), data)
+}
+
+// writeFileAtomic replaces the file with data, so that readers never see it partially written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (d *Downloader) downloadPair(ctx context.Context, pair string) error {
+	pageSize := d.PageSize
+	if pageSize <= 0 || pageSize > maxUserTradesLimit {
+		pageSize = maxUserTradesLimit
+	}
+
+	store := &tradeStore{path: d.StorePath(pair), format: d.format}
+	seen, err := store.ids()
+	if err != nil {
+		return err
+	}
+	cp, err := d.Checkpoint(pair)
+	if err != nil {
+		return err
+	}
+
+	// save stores unseen trades of the page and returns the number of trades newer than the checkpoint
+	save := func(page []UserTrade, newest int64) (int, error) {
+		var fresh []UserTrade
+		newer := 0
+		for _, t := range page {
+			if t.TradeId > newest {
+				newer++
+			}
+			if !seen[t.TradeId] {
+				seen[t.TradeId] = true
+				fresh = append(fresh, t)
+			}
+			if t.TradeId > cp.Newest {
+				cp.Newest = t.TradeId
+			}
+			if cp.Oldest == 0 || t.TradeId < cp.Oldest {
+				cp.Oldest = t.TradeId
+			}
+		}
+		if len(fresh) == 0 {
+			return newer, nil
+		}
+		return newer, store.append(fresh)
+	}
+
+	// catch up with trades made since the previous run, they shift offsets of the older ones
+	shift := 0
+	if cp.Newest > 0 {
+		known := cp.Newest
+		for offset := 0; ; {
+			page, err := d.ex.userTradesPage(ctx, pair, offset, pageSize)
+			if err != nil {
+				return err
+			}
+			newer, err := save(page, known)
+			if err != nil {
+				return err
+			}
+			shift += newer
+			offset += len(page)
+			if newer < len(page) || len(page) < pageSize {
+				break
+			}
+		}
+		if cp.Complete {
+			return d.saveCheckpoint(cp)
+		}
+	}
+
+	// continue from the offset reached before, one trade earlier so that the page starts with the oldest stored trade
+	offset := cp.Offset + shift
+	resumed := cp.Oldest > 0 && offset > 0
+	if resumed {
+		offset--
+	}
+	for {
+		page, err := d.ex.userTradesPage(ctx, pair, offset, pageSize)
+		if err != nil {
+			return err
+		}
+		if resumed && offset > 0 && (len(page) == 0 || page[0].TradeId < cp.Oldest) {
+			// the offset went past stored trades (e.g. trades were made during the previous run), step back to overlap;
+			// a page starting with a newer trade overlaps stored ones, which are skipped
+			offset -= pageSize
+			if offset < 0 {
+				offset = 0
+			}
+			continue
+		}
+		resumed = false
+		if _, err := save(page, cp.Newest); err != nil {
+			return err
+		}
+
+		offset += len(page)
+		cp.Offset = offset
+		cp.Complete = len(page) < pageSize
+		if err := d.saveCheckpoint(cp); err != nil {
+			return err
+		}
+		if cp.Complete {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,151 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"encoding/csv"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// storedIds reads trade ids from the store and fails on duplicates.
+func storedIds(t *testing.T, d *Downloader, pair string) map[int64]bool {
+	store := &tradeStore{path: d.StorePath(pair), format: d.format}
+	ids, err := store.ids()
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(d.StorePath(pair))
+	require.NoError(t, err)
+	lines := strings.Count(string(data), "\n")
+	if d.format == FormatCSV {
+		lines-- // header
+	}
+	require.Equal(t, len(ids), lines, "duplicated trades in store")
+	return ids
+}
+
+func TestDownloader(t *testing.T) {
+	for _, format := range []StoreFormat{FormatJSONLines, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "exmo")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			total := map[string]int{"BTC_RUB": 95}
+			var requests []string
+			failAfter := 4
+			trades := stubUserTrades(total, &requests)
+			api := stubApi(func(method string, params url.Values) string {
+				if failAfter == 0 {
+					return `{"result":false,"error":"Error 40005: connection lost"}`
+				}
+				failAfter--
+				return trades(method, params)
+			})
+			d := NewDownloader(&api, dir, format)
+			d.PageSize = 10
+
+			// the first run dies in the middle
+			require.Error(t, d.Download(context.Background(), "BTC_RUB"))
+			cp, err := d.Checkpoint("BTC_RUB")
+			require.NoError(t, err)
+			require.Equal(t, Checkpoint{Pair: "BTC_RUB", Newest: 94, Oldest: 55, Offset: 40, Updated: cp.Updated}, cp)
+			require.Len(t, storedIds(t, d, "BTC_RUB"), 40)
+
+			// new trades are made before the download resumes
+			total["BTC_RUB"] = 100
+			failAfter = -1
+			requests = nil
+			require.NoError(t, d.Download(context.Background(), "BTC_RUB"))
+			// the download resumes right at the oldest stored trade, without stepping back
+			require.Equal(t, []string{"BTC_RUB:0", "BTC_RUB:44", "BTC_RUB:54", "BTC_RUB:64", "BTC_RUB:74", "BTC_RUB:84", "BTC_RUB:94"}, requests)
+
+			ids := storedIds(t, d, "BTC_RUB")
+			require.Len(t, ids, 100)
+			for id := int64(0); id < 100; id++ {
+				require.True(t, ids[id], "trade %d is missing", id)
+			}
+			cp, _ = d.Checkpoint("BTC_RUB")
+			require.True(t, cp.Complete)
+
+			// the next run only catches up with new trades
+			total["BTC_RUB"] = 103
+			requests = nil
+			require.NoError(t, d.Download(context.Background(), "BTC_RUB"))
+			require.Equal(t, []string{"BTC_RUB:0"}, requests)
+			require.Len(t, storedIds(t, d, "BTC_RUB"), 103)
+		})
+	}
+
+	t.Run("StepBack", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "exmo")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		total := map[string]int{"BTC_RUB": 50}
+		var requests []string
+		api := stubApi(stubUserTrades(total, &requests))
+		d := NewDownloader(&api, dir, FormatJSONLines)
+		d.PageSize = 10
+
+		// checkpoint offset is ahead of the stored trades, e.g. trades were made during the previous run
+		require.NoError(t, d.saveCheckpoint(Checkpoint{Pair: "BTC_RUB", Newest: 49, Oldest: 40, Offset: 30}))
+		store := &tradeStore{path: d.StorePath("BTC_RUB"), format: FormatJSONLines}
+		page, err := api.userTradesPage(context.Background(), "BTC_RUB", 0, 10)
+		require.NoError(t, err)
+		require.NoError(t, store.append(page))
+
+		requests = nil
+		require.NoError(t, d.Download(context.Background(), "BTC_RUB"))
+		require.Equal(t, []string{"BTC_RUB:0", "BTC_RUB:29", "BTC_RUB:19", "BTC_RUB:9", "BTC_RUB:19", "BTC_RUB:29", "BTC_RUB:39", "BTC_RUB:49"}, requests)
+		require.Len(t, storedIds(t, d, "BTC_RUB"), 50)
+	})
+
+	t.Run("TornLine", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "exmo")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		d := NewDownloader(nil, dir, FormatCSV)
+		store := &tradeStore{path: d.StorePath("BTC_RUB"), format: FormatCSV}
+		require.NoError(t, store.append([]UserTrade{{TradeId: 1, Pair: "BTC_RUB"}, {TradeId: 2, Pair: "BTC_RUB"}}))
+
+		f, err := os.OpenFile(store.path, os.O_APPEND|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.WriteString("3,2019-10")
+		require.NoError(t, err)
+		f.Close()
+
+		ids, err := store.ids()
+		require.NoError(t, err)
+		require.Equal(t, map[int64]bool{1: true, 2: true}, ids)
+
+		f, err = os.Open(store.path)
+		require.NoError(t, err)
+		defer f.Close()
+		records, err := csv.NewReader(f).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		require.Equal(t, TradeColumns, records[0])
+	})
+}
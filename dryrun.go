@@ -0,0 +1,129 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// readOnlyMethods are authenticated API methods sent in dry-run mode. Every other authenticated method
+// is intercepted, so methods that create or cancel orders or move funds (order_create, stop_market_order_create,
+// withdraw_crypt, excode_create etc.) are never sent, including those this list doesn't know about.
+var readOnlyMethods = map[string]bool{
+	"user_info":             true,
+	"user_trades":           true,
+	"user_open_orders":      true,
+	"user_cancelled_orders": true,
+	"order_trades":          true,
+	"required_amount":       true,
+	"deposit_address":       true,
+	"wallet_history":        true,
+	"withdraw_get_txid":     true,
+}
+
+// intercepted reports whether the request is not sent in dry-run mode. Public methods are always sent.
+func (d *dryRun) intercepted(mode string, method string) bool {
+	return mode == "authenticated" && !readOnlyMethods[method]
+}
+
+// dryRun intercepts requests that create or cancel orders or move funds.
+type dryRun struct {
+	logf func(format string, v ...interface{})
+}
+
+// WithDryRun switches the client to dry-run ("shadow") mode: requests that create or cancel orders or move
+// funds (every authenticated method except the read-only ones) are validated, signed and logged, but never sent,
+// and synthetic successful responses are returned. Orders are checked against pair settings as with
+// WithOrderValidation. Market data, balances, open orders and history requests are sent as usual.
+// Synthetic orders don't exist on the exchange, so requests about them (e.g. GetOrderTrades) fail
+// as for unknown orders. A nil logger writes to the standard logger.
+func WithDryRun(logger *log.Logger) Option {
+	return func(ex *Exmo) {
+		d := &dryRun{logf: log.Printf}
+		if logger != nil {
+			d.logf = logger.Printf
+		}
+		ex.dryRun = d
+	}
+}
+
+// DryRun reports whether the client is in dry-run mode.
+func (ex *Exmo) DryRun() bool {
+	return ex.dryRun != nil
+}
+
+// intercept validates and signs the request as if it was sent and returns synthetic response body.
+func (d *dryRun) intercept(ctx context.Context, ex *Exmo, mode string, method string, params ApiParams) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateDryRun(method, params); err != nil {
+		return nil, err
+	}
+
+	content, sign := ex.encode(mode, params)
+	d.logf("dry run: %s %s sign=%s...", method, content, sign[:16])
+
+	resp := map[string]interface{}{"result": true, "error": "", "dry_run": true}
+	switch method {
+	case "order_create":
+		resp["order_id"] = NewClientId()
+	case "stop_market_order_create":
+		resp["parent_order_id"] = NewClientId()
+	case "withdraw_crypt", "excode_create":
+		resp["task_id"] = strconv.FormatInt(NewClientId(), 10)
+	}
+	return json.Marshal(resp)
+}
+
+// validateDryRun checks params the exchange would reject. Orders are validated against pair settings before.
+func validateDryRun(method string, params ApiParams) error {
+	switch method {
+	case "order_cancel":
+		if _, err := strconv.ParseInt(params["order_id"], 10, 64); err != nil {
+			return fmt.Errorf("invalid order id %q", params["order_id"])
+		}
+	case "stop_market_order_cancel":
+		if _, err := strconv.ParseInt(params["parent_order_id"], 10, 64); err != nil {
+			return fmt.Errorf("invalid order id %q", params["parent_order_id"])
+		}
+	case "withdraw_crypt":
+		return requireFunds("withdrawal", params, "currency", "address")
+	case "excode_create":
+		return requireFunds("excode", params, "currency")
+	}
+	return nil
+}
+
+// requireFunds checks the amount of a fund transfer and its required params.
+func requireFunds(operation string, params ApiParams, required ...string) error {
+	amount, err := strconv.ParseFloat(params["amount"], 64)
+	if err != nil || amount <= 0 {
+		return fmt.Errorf("invalid %s amount %q", operation, params["amount"])
+	}
+	for _, key := range required {
+		if strings.TrimSpace(params[key]) == "" {
+			return fmt.Errorf("%s %s is required", operation, key)
+		}
+	}
+	return nil
+}
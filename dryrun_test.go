@@ -0,0 +1,103 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"bytes"
+	"log"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRun(t *testing.T) {
+	var sent []string
+	var buf bytes.Buffer
+	api := stubApi(func(method string, params url.Values) string {
+		sent = append(sent, method)
+		switch method {
+		case "pair_settings":
+			return testPairSettings
+		case "user_info":
+			return `{"uid":1,"balances":{"RUB":"1000"},"reserved":{"RUB":"0"}}`
+		}
+		return `{"result":true,"error":"","order_id":1}`
+	}, WithDryRun(log.New(&buf, "", 0)), WithClientOrderIds())
+	require.True(t, api.DryRun())
+
+	resp, err := api.Buy("BTC_RUB", "0.01", "990000")
+	require.NoError(t, err)
+	require.Equal(t, true, resp["dry_run"])
+	require.NotZero(t, resp["order_id"])
+	require.NotZero(t, resp["client_id"])
+	_, err = orderIdOf(resp)
+	require.NoError(t, err)
+
+	// orders are validated as they would be by the exchange
+	_, err = api.Buy("BTC_RUB", "0.0001", "990000")
+	_, ok := err.(*OrderValidationError)
+	require.True(t, ok, "unexpected error %v", err)
+
+	_, err = api.OrderCancel("12345")
+	require.NoError(t, err)
+	_, err = api.OrderCancel("")
+	require.Error(t, err)
+
+	resp, err = api.Api_query("authenticated", "withdraw_crypt", ApiParams{"amount": "0.1", "currency": "BTC", "address": "1A1z"})
+	require.NoError(t, err)
+	require.NotEmpty(t, resp["task_id"])
+	_, err = api.Api_query("authenticated", "withdraw_crypt", ApiParams{"amount": "0.1", "currency": "BTC"})
+	require.Error(t, err)
+
+	// read-only requests still go to the exchange
+	_, err = api.GetUserInfo()
+	require.NoError(t, err)
+	require.Equal(t, []string{"pair_settings", "user_info"}, sent)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[0], "dry run: order_create ")
+	require.Contains(t, lines[0], "pair=BTC_RUB")
+	require.Contains(t, lines[0], "nonce=")
+	require.Contains(t, lines[1], "dry run: order_cancel ")
+	require.Contains(t, lines[1], "order_id=12345")
+	require.Contains(t, lines[2], "dry run: withdraw_crypt ")
+
+	// every method creating or cancelling orders or moving funds is intercepted, even if unknown to the client
+	sent = nil
+	buf.Reset()
+	for method, params := range map[string]ApiParams{
+		"excode_create":            {"amount": "100", "currency": "RUB"},
+		"excode_load":              {"code": "EX-CODE_1"},
+		"stop_market_order_create": {"pair": "BTC_RUB", "quantity": "0.01", "trigger_price": "900000", "type": "sell"},
+		"stop_market_order_cancel": {"parent_order_id": "123"},
+		"margin/user/order/create": {"pair": "BTC_RUB"},
+	} {
+		resp, err := api.Api_query("authenticated", method, params)
+		require.NoError(t, err, method)
+		require.Equal(t, true, resp["dry_run"], method)
+	}
+	_, err = api.Api_query("authenticated", "excode_create", ApiParams{"amount": "0", "currency": "RUB"})
+	require.Error(t, err)
+	require.Empty(t, sent)
+	require.Equal(t, 5, strings.Count(buf.String(), "dry run: "))
+
+	live := stubApi(func(method string, params url.Values) string { return `{}` })
+	require.False(t, live.DryRun())
+}
@@ -0,0 +1,115 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+)
+
+// ExecutionEstimate describes hypothetical execution of a market order against the order book.
+type ExecutionEstimate struct {
+	Pair               string
+	TypeOrder          string
+	Quantity           float64 // base currency filled
+	Amount             float64 // quote currency spent (buy) or received before commission (sell)
+	BestPrice          float64 // top of the book before execution
+	AvgPrice           float64
+	WorstPrice         float64 // price of the last level touched
+	SlippageBps        float64 // adverse deviation of AvgPrice from BestPrice in basis points
+	Commission         float64 // taker commission, charged in the received currency
+	CommissionCurrency string
+	Net                float64 // received currency after commission
+	Levels             int     // number of book levels touched
+	Complete           bool    // false if the book is not deep enough to fill the whole order
+}
+
+// EstimateExecution walks the book snapshot and estimates execution of market order (market_buy, market_buy_total,
+// market_sell or market_sell_total) with the quantity param as it would be passed to OrderCreate.
+func EstimateExecution(book OrderBook, settings PairSettings, typeOrder string, quantity float64) (ExecutionEstimate, error) {
+	base, quote, err := SplitPair(book.Pair)
+	if err != nil {
+		return ExecutionEstimate{}, err
+	}
+	if quantity <= 0 {
+		return ExecutionEstimate{}, fmt.Errorf("invalid quantity %v", quantity)
+	}
+
+	var side []BookLevel
+	var buy bool
+	switch typeOrder {
+	case "market_buy", "market_buy_total":
+		side, buy = book.Ask, true
+	case "market_sell", "market_sell_total":
+		side, buy = book.Bid, false
+	default:
+		return ExecutionEstimate{}, fmt.Errorf("can't estimate %q order, only market orders are supported", typeOrder)
+	}
+
+	est := ExecutionEstimate{Pair: book.Pair, TypeOrder: typeOrder}
+	if len(side) == 0 {
+		return est, nil
+	}
+
+	// takeLiquidity consumes levels, so walk a copy to keep the snapshot intact
+	levels := append([]BookLevel(nil), side...)
+	byAmount := typeOrder == "market_buy_total" || typeOrder == "market_sell_total"
+	fills := takeLiquidity(levels, quantity, byAmount, nil)
+
+	est.BestPrice = side[0].Price
+	est.Levels = len(fills)
+	est.Quantity = filledQuantity(fills, false)
+	est.Amount = filledAmount(fills)
+	est.Complete = filledQuantity(fills, byAmount) >= quantity-epsilon
+	if len(fills) == 0 {
+		return est, nil
+	}
+	est.AvgPrice = est.Amount / est.Quantity
+	est.WorstPrice = fills[len(fills)-1].Price
+
+	fee := settings.CommissionTakerPercent / 100
+	if buy {
+		est.SlippageBps = (est.AvgPrice - est.BestPrice) / est.BestPrice * 10000
+		est.Commission = est.Quantity * fee
+		est.CommissionCurrency = base
+		est.Net = est.Quantity - est.Commission
+	} else {
+		est.SlippageBps = (est.BestPrice - est.AvgPrice) / est.BestPrice * 10000
+		est.Commission = est.Amount * fee
+		est.CommissionCurrency = quote
+		est.Net = est.Amount - est.Commission
+	}
+
+	return est, nil
+}
+
+// EstimateExecution fetches the order book and estimates execution of market order locally,
+// see EstimateExecution function. Only public API is used, so credentials are not required.
+func (ex *Exmo) EstimateExecution(pair string, typeOrder string, quantity float64) (ExecutionEstimate, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return ExecutionEstimate{}, err
+	}
+	resp, err := ex.GetOrderBook(pair, 1000)
+	if err != nil {
+		return ExecutionEstimate{}, err
+	}
+	book, err := ParseOrderBook(resp, pair)
+	if err != nil {
+		return ExecutionEstimate{}, err
+	}
+	return EstimateExecution(book, settings, typeOrder, quantity)
+}
@@ -0,0 +1,82 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateExecution(t *testing.T) {
+	market := newStubMarket()
+	resp, _ := market.GetOrderBook("BTC_RUB", 100)
+	book, err := ParseOrderBook(resp, "BTC_RUB")
+	require.NoError(t, err)
+	settings, err := ParsePairSettings(decodeResponse(testPairSettings))
+	require.NoError(t, err)
+
+	t.Run("MarketBuy", func(t *testing.T) {
+		est, err := EstimateExecution(book, settings["BTC_RUB"], "market_buy", 1)
+		require.NoError(t, err)
+		require.True(t, est.Complete)
+		require.Equal(t, 2, est.Levels)
+		require.InDelta(t, 1000500, est.AvgPrice, 1e-6)
+		require.Equal(t, 1001000.0, est.WorstPrice)
+		require.InDelta(t, 5, est.SlippageBps, 1e-9)
+		require.InDelta(t, 0.004, est.Commission, 1e-12)
+		require.Equal(t, "BTC", est.CommissionCurrency)
+
+		// snapshot is not consumed
+		require.Equal(t, 0.5, book.Ask[0].Quantity)
+	})
+
+	t.Run("MarketSellTotal", func(t *testing.T) {
+		est, err := EstimateExecution(book, settings["BTC_RUB"], "market_sell_total", 499500)
+		require.NoError(t, err)
+		require.True(t, est.Complete)
+		require.Equal(t, 1, est.Levels)
+		require.InDelta(t, 0.5, est.Quantity, 1e-12)
+		require.InDelta(t, 0, est.SlippageBps, 1e-9)
+		require.InDelta(t, 499500*0.996, est.Net, 1e-6)
+	})
+
+	t.Run("NotDeepEnough", func(t *testing.T) {
+		est, err := EstimateExecution(book, settings["BTC_RUB"], "market_sell", 5)
+		require.NoError(t, err)
+		require.False(t, est.Complete)
+		require.InDelta(t, 1.5, est.Quantity, 1e-12)
+	})
+
+	t.Run("LimitOrder", func(t *testing.T) {
+		_, err := EstimateExecution(book, settings["BTC_RUB"], "buy", 1)
+		require.Error(t, err)
+	})
+
+	t.Run("Exmo", func(t *testing.T) {
+		api := stubApi(func(method string, params url.Values) string {
+			if method == "order_book" {
+				return `{"BTC_RUB":` + market.books["BTC_RUB"] + `}`
+			}
+			return testPairSettings
+		})
+		est, err := api.EstimateExecution("BTC_RUB", "market_buy", 0.5)
+		require.NoError(t, err)
+		require.Equal(t, 1000000.0, est.AvgPrice)
+	})
+}
@@ -38,7 +38,7 @@ func main() {
 
 	resultTrades, err := api.GetTrades("BTC_RUB")
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for _, v := range resultTrades {
 			for k, val := range v.([]interface{}) {
@@ -62,7 +62,7 @@ func main() {
 
 	resultBook, err := api.GetOrderBook("BTC_RUB", 200)
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for _, v := range resultBook {
 			for key, value := range v.(map[string]interface{}) {
@@ -218,7 +218,7 @@ func main() {
 			if key == "order_id" && value != nil {
 				val := strconv.Itoa(int(value.(float64)))
 				orderId = val
-				fmt.Printf("Order id: %f", orderId)
+				fmt.Printf("Order id: %s", orderId)
 			}
 		}
 	}
@@ -260,7 +260,7 @@ func main() {
 
 	resultUserOpenOrders, err := api.GetUserOpenOrders()
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for _, v := range resultUserOpenOrders {
 			for _, val := range v.([]interface{}) {
@@ -273,7 +273,7 @@ func main() {
 
 	resultUserCancelledOrders, err := api.GetUserCancelledOrders(0, 100)
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for _, v := range resultUserCancelledOrders {
 			for key, val := range v.(map[string]interface{}) {
@@ -290,7 +290,7 @@ func main() {
 
 	resultOrderTrades, err := api.GetOrderTrades(orderId)
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for k, v := range resultOrderTrades {
 			fmt.Println(k, v)
@@ -299,7 +299,7 @@ func main() {
 
 	resultRequiredAmount, err := api.GetRequiredAmount("BTC_RUB", "0.01")
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for k, v := range resultRequiredAmount {
 			fmt.Println(k, v)
@@ -308,7 +308,7 @@ func main() {
 
 	resultDepositAddress, err := api.GetDepositAddress()
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for k, v := range resultDepositAddress {
 			fmt.Println(k, v)
@@ -325,7 +325,7 @@ func main() {
 	resultWalletHistory, err := api.GetWalletHistory(date.Truncate(subdate))
 
 	if err != nil {
-		fmt.Errorf("api error: %s\n", err)
+		fmt.Printf("api error: %s\n", err)
 	} else {
 		for k, v := range resultWalletHistory {
 			if k == "history" {
@@ -18,6 +18,7 @@ package exmo
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/json"
@@ -38,13 +39,30 @@ type ApiParams map[string]string
 
 // Exmo holds client-specific info.
 type Exmo struct {
-	key    string // public key
-	secret string // secret key
-	client *http.Client
+	key            string // public key
+	secret         string // secret key
+	client         *http.Client
+	settings       *settingsCache
+	validateOrders bool
+	limiter        *RateLimiter
+	clientIds      bool
+	dryRun         *dryRun
+}
+
+// Option configures Exmo instance.
+type Option func(*Exmo)
+
+// WithOrderValidation makes OrderCreate (and all methods built on it) check orders against pair settings
+// before sending them. Pair settings are cached and refreshed after ttl (0 means never).
+func WithOrderValidation(ttl time.Duration) Option {
+	return func(ex *Exmo) {
+		ex.validateOrders = true
+		ex.settings.ttl = ttl
+	}
 }
 
 // Api creates Exmo instance with specified credentials.
-func Api(key string, secret string) Exmo {
+func Api(key string, secret string, opts ...Option) Exmo {
 	var netTransport = &http.Transport{
 		MaxIdleConns:        30,
 		MaxConnsPerHost:     1,
@@ -55,26 +73,54 @@ func Api(key string, secret string) Exmo {
 		Timeout:   time.Second * 10,
 		Transport: netTransport,
 	}
-	return Exmo{key, secret, client}
+	ex := Exmo{key: key, secret: secret, client: client, settings: &settingsCache{}, limiter: NewRateLimiter(DefaultRateLimit)}
+	for _, opt := range opts {
+		opt(&ex)
+	}
+	return ex
 }
 
 // Api_query is a general query method for API calls.
 func (ex *Exmo) Api_query(mode string, method string, params ApiParams) (ApiResponse, error) {
+	return ex.Api_queryContext(context.Background(), mode, method, params)
+}
 
-	post_params := url.Values{}
-	if mode == "authenticated" {
-		post_params.Add("nonce", nonce())
+// Api_queryContext is Api_query that waits for the rate limiter and sends request within the context.
+func (ex *Exmo) Api_queryContext(ctx context.Context, mode string, method string, params ApiParams) (ApiResponse, error) {
+	body, err := ex.send(ctx, mode, method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var dat map[string]interface{}
+	err2 := json.Unmarshal([]byte(body), &dat)
+	if err2 != nil {
+		return nil, err2
 	}
-	if params != nil {
-		for key, value := range params {
-			post_params.Add(key, value)
+
+	if result, ok := dat["result"]; ok && result.(bool) != true {
+		return nil, errors.New(dat["error"].(string))
+	}
+
+	return dat, nil
+}
+
+// send signs and sends API request and returns raw response body.
+func (ex *Exmo) send(ctx context.Context, mode string, method string, params ApiParams) ([]byte, error) {
+	if ex.dryRun != nil && ex.dryRun.intercepted(mode, method) {
+		return ex.dryRun.intercept(ctx, ex, mode, method, params)
+	}
+
+	if ex.limiter != nil {
+		if err := ex.limiter.Wait(ctx); err != nil {
+			return nil, err
 		}
 	}
-	post_content := post_params.Encode()
 
-	sign := ex.Do_sign(post_content)
+	post_content, sign := ex.encode(mode, params)
 
 	req, _ := http.NewRequest("POST", "https://api.exmo.com/v1/"+method, bytes.NewBuffer([]byte(post_content)))
+	req = req.WithContext(ctx)
 	req.Header.Set("Key", ex.key)
 	req.Header.Set("Sign", sign)
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
@@ -90,22 +136,21 @@ func (ex *Exmo) Api_query(mode string, method string, params ApiParams) (ApiResp
 		return nil, errors.New("http status: " + resp.Status)
 	}
 
-	body, err1 := ioutil.ReadAll(resp.Body)
-	if err1 != nil {
-		return nil, err1
-	}
+	return ioutil.ReadAll(resp.Body)
+}
 
-	var dat map[string]interface{}
-	err2 := json.Unmarshal([]byte(body), &dat)
-	if err2 != nil {
-		return nil, err2
+// encode builds POST data of the request and its signature.
+func (ex *Exmo) encode(mode string, params ApiParams) (string, string) {
+	post_params := url.Values{}
+	if mode == "authenticated" {
+		post_params.Add("nonce", nonce())
 	}
-
-	if result, ok := dat["result"]; ok && result.(bool) != true {
-		return nil, errors.New(dat["error"].(string))
+	for key, value := range params {
+		post_params.Add(key, value)
 	}
+	post_content := post_params.Encode()
 
-	return dat, nil
+	return post_content, ex.Do_sign(post_content)
 }
 
 // nonce generates request parameter ‘nonce’ with incremental numerical value (>0). The incremental numerical value should never reiterate or decrease.
@@ -135,7 +180,7 @@ func (ex *Exmo) GetOrderBook(pair string, limit int) (ApiResponse, error) {
 		return nil, errors.New("limit param must be in range of 100-1000")
 	}
 
-	return ex.Api_query("public", "order_book", ApiParams{"pair": pair, "limit": string(limit)})
+	return ex.Api_query("public", "order_book", ApiParams{"pair": pair, "limit": strconv.Itoa(limit)})
 }
 
 // Ticker return statistics on prices and volume of trades by currency pairs.
@@ -185,12 +230,48 @@ func (ex *Exmo) GetUserInfo() (ApiResponse, error) {
 
 // GetUserTrades return the list of user’s deals.
 func (ex *Exmo) GetUserTrades(pair string, offset, limit int) (ApiResponse, error) {
-	return ex.Api_query("authenticated", "user_trades", ApiParams{"pair": pair, "limit": string(limit), "offset": string(offset)})
+	return ex.Api_query("authenticated", "user_trades", ApiParams{"pair": pair, "limit": strconv.Itoa(limit), "offset": strconv.Itoa(offset)})
 }
 
 // OrderCreate creates order
 func (ex *Exmo) OrderCreate(pair string, quantity string, price string, typeOrder string) (ApiResponse, error) {
-	return ex.Api_query("authenticated", "order_create", ApiParams{"pair": pair, "quantity": quantity, "price": price, "type": typeOrder})
+	var clientId int64
+	if ex.clientIds {
+		clientId = NewClientId()
+	}
+	return ex.OrderCreateWithClientId(pair, quantity, price, typeOrder, clientId)
+}
+
+// OrderCreateWithClientId creates order tagged with client order id (0 means no id), so that the order
+// can be found with FindOrderByClientId if the response is lost. The id is returned in "client_id" field
+// of the response, request errors come as *ClientOrderError carrying the id.
+func (ex *Exmo) OrderCreateWithClientId(pair string, quantity string, price string, typeOrder string, clientId int64) (ApiResponse, error) {
+	if ex.validateOrders || ex.dryRun != nil {
+		settings, err := ex.CachedPairSettings(pair)
+		if err != nil {
+			return nil, err
+		}
+		quantity, price, err = ValidateOrder(settings, pair, quantity, price, typeOrder)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	params := ApiParams{"pair": pair, "quantity": quantity, "price": price, "type": typeOrder}
+	if clientId != 0 {
+		params["client_id"] = strconv.FormatInt(clientId, 10)
+	}
+	resp, err := ex.Api_query("authenticated", "order_create", params)
+	if err != nil {
+		if clientId != 0 {
+			return nil, &ClientOrderError{ClientId: clientId, Err: err}
+		}
+		return nil, err
+	}
+	if _, ok := resp["client_id"]; !ok && clientId != 0 {
+		resp["client_id"] = float64(clientId)
+	}
+	return resp, nil
 }
 
 // Buy creates buy order
@@ -233,14 +314,31 @@ func (ex *Exmo) GetUserOpenOrders() (ApiResponse, error) {
 	return ex.Api_query("authenticated", "user_open_orders", ApiParams{})
 }
 
-// GetUserCancelledOrders returns the list of user’s deals
+// GetUserCancelledOrders returns the list of user’s cancelled orders
 // This method almost completely copies Api_query method, but it returns array of interfaces, not map
-func (ex *Exmo) GetUserCancelledOrders(offset uint, limit uint) (ApiResponse, error) {
+func (ex *Exmo) GetUserCancelledOrders(offset uint, limit uint) ([]interface{}, error) {
 	if limit < 100 || limit > 1000 {
 		return nil, errors.New("limit param must be in range of 100-1000")
 	}
 
-	return ex.Api_query("authenticated", "order_cancel", ApiParams{"offset": string(offset), "limit": string(limit)})
+	body, err := ex.send(context.Background(), "authenticated", "user_cancelled_orders", ApiParams{"offset": strconv.Itoa(int(offset)), "limit": strconv.Itoa(int(limit))})
+	if err != nil {
+		return nil, err
+	}
+
+	var dat []interface{}
+	if err := json.Unmarshal(body, &dat); err != nil {
+		// errors come as an object
+		var failure map[string]interface{}
+		if json.Unmarshal(body, &failure) == nil {
+			if msg, ok := failure["error"].(string); ok && msg != "" {
+				return nil, errors.New(msg)
+			}
+		}
+		return nil, err
+	}
+
+	return dat, nil
 }
 
 // GetOrderTrades returns the list of user’s cancelled orders
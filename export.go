@@ -0,0 +1,157 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CancelledOrder is a single user's cancelled order.
+type CancelledOrder struct {
+	Date     time.Time
+	OrderId  int64
+	Type     string // buy, sell, market_buy etc.
+	Pair     string
+	Quantity float64
+	Price    float64
+	Amount   float64
+	// Raw holds decimal strings of quantity, price and amount as sent by the exchange. They are exported
+	// instead of the float values.
+	Raw map[string]string
+}
+
+// ParseCancelledOrders converts GetUserCancelledOrders response to typed orders.
+func ParseCancelledOrders(list []interface{}) ([]CancelledOrder, error) {
+	orders := make([]CancelledOrder, 0, len(list))
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cancelled orders: unexpected format")
+		}
+
+		o := CancelledOrder{Raw: map[string]string{}}
+		var err error
+		var date, orderId float64
+		for key, dst := range map[string]*float64{
+			"date":     &date,
+			"order_id": &orderId,
+			"quantity": &o.Quantity,
+			"price":    &o.Price,
+			"amount":   &o.Amount,
+		} {
+			if v, ok := fields[key]; ok && v != nil {
+				if *dst, err = toFloat(v); err != nil {
+					return nil, fmt.Errorf("cancelled orders: %s: %s", key, err)
+				}
+				keepDecimal(o.Raw, key, v)
+			}
+		}
+		o.Date = time.Unix(int64(date), 0).UTC()
+		o.OrderId = int64(orderId)
+		o.Type, _ = fields["order_type"].(string)
+		o.Pair, _ = fields["pair"].(string)
+
+		orders = append(orders, o)
+	}
+	return orders, nil
+}
+
+// CancelledOrderColumns is the stable column set of exported cancelled orders.
+var CancelledOrderColumns = []string{"order_id", "date", "pair", "type", "quantity", "price", "amount"}
+
+// WalletOperationColumns is the stable column set of exported wallet history.
+var WalletOperationColumns = []string{"date", "type", "currency", "amount", "commission", "status", "provider", "account", "txid"}
+
+// ExportTrades writes trades as CSV (with header) or JSON Lines with TradeColumns, UTC timestamps and exact decimal strings.
+func ExportTrades(w io.Writer, format StoreFormat, trades []UserTrade) error {
+	rows := make([][]string, 0, len(trades))
+	for _, t := range trades {
+		rows = append(rows, tradeRow(t))
+	}
+	return export(w, format, TradeColumns, rows)
+}
+
+// ExportCancelledOrders writes cancelled orders as CSV (with header) or JSON Lines with CancelledOrderColumns.
+func ExportCancelledOrders(w io.Writer, format StoreFormat, orders []CancelledOrder) error {
+	rows := make([][]string, 0, len(orders))
+	for _, o := range orders {
+		rows = append(rows, []string{
+			strconv.FormatInt(o.OrderId, 10),
+			o.Date.UTC().Format(time.RFC3339),
+			o.Pair,
+			o.Type,
+			decimal(o.Raw, "quantity", o.Quantity),
+			decimal(o.Raw, "price", o.Price),
+			decimal(o.Raw, "amount", o.Amount),
+		})
+	}
+	return export(w, format, CancelledOrderColumns, rows)
+}
+
+// ExportWalletHistory writes wallet operations as CSV (with header) or JSON Lines with WalletOperationColumns.
+func ExportWalletHistory(w io.Writer, format StoreFormat, operations []WalletOperation) error {
+	rows := make([][]string, 0, len(operations))
+	for _, op := range operations {
+		rows = append(rows, []string{
+			op.Date.UTC().Format(time.RFC3339),
+			op.Type,
+			op.Currency,
+			decimal(op.Raw, "amount", op.Amount),
+			decimal(op.Raw, "commission", op.Commission),
+			op.Status,
+			op.Provider,
+			op.Account,
+			op.TxId,
+		})
+	}
+	return export(w, format, WalletOperationColumns, rows)
+}
+
+func export(w io.Writer, format StoreFormat, columns []string, rows [][]string) error {
+	if format == FormatCSV {
+		rows = append([][]string{columns}, rows...)
+	}
+	return writeRows(w, format, columns, rows)
+}
+
+// AllCancelledOrders requests all pages of user's cancelled orders, ordered by date.
+func (ex *Exmo) AllCancelledOrders() ([]CancelledOrder, error) {
+	const limit = 1000
+
+	var orders []CancelledOrder
+	for offset := 0; ; offset += limit {
+		list, err := ex.GetUserCancelledOrders(uint(offset), limit)
+		if err != nil {
+			return nil, err
+		}
+		page, err := ParseCancelledOrders(list)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, page...)
+		if len(list) < limit {
+			break
+		}
+	}
+
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].Date.Before(orders[j].Date) })
+	return orders, nil
+}
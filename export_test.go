@@ -0,0 +1,140 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	trades := []UserTrade{{
+		TradeId: 3, Date: time.Unix(1435488248, 0), Type: "buy", Pair: "BTC_RUB", OrderId: 7,
+		Quantity: 0.12345678, Price: 1000000.01, Amount: 123456.79234567, ExecType: "taker",
+		CommissionAmount: 0.00049383, CommissionCurrency: "BTC", CommissionPercent: 0.4,
+	}}
+
+	t.Run("TradesCSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, ExportTrades(&buf, FormatCSV, trades))
+		require.Equal(t, strings.Join(TradeColumns, ",")+"\n"+
+			"3,2015-06-28T10:44:08Z,BTC_RUB,buy,7,0.12345678,1000000.01,123456.79234567,taker,0.00049383,BTC,0.4\n", buf.String())
+	})
+
+	t.Run("TradesJSONLines", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, ExportTrades(&buf, FormatJSONLines, trades))
+		require.Equal(t, `{"trade_id":"3","date":"2015-06-28T10:44:08Z","pair":"BTC_RUB","type":"buy","order_id":"7",`+
+			`"quantity":"0.12345678","price":"1000000.01","amount":"123456.79234567","exec_type":"taker",`+
+			`"commission_amount":"0.00049383","commission_currency":"BTC","commission_percent":"0.4"}`+"\n", buf.String())
+	})
+
+	t.Run("WalletCSV", func(t *testing.T) {
+		operations, err := ParseWalletHistory(decodeResponse(`{"history":[
+			{"dt":1461841192,"type":"deposit","curr":"RUB","status":"processing","provider":"Qiwi (LA) [12345]","amount":"1","account":""},
+			{"dt":1463414785,"type":"withdrawal","curr":"USD","status":"paid","provider":"EXCODE","amount":"-1","account":"EX-CODE_19371_USDda...","commission":"0.5"}]}`))
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, ExportWalletHistory(&buf, FormatCSV, operations))
+		require.Equal(t, "date,type,currency,amount,commission,status,provider,account,txid\n"+
+			"2016-04-28T10:59:52Z,deposit,RUB,1,0,processing,Qiwi (LA) [12345],,\n"+
+			"2016-05-16T16:06:25Z,withdrawal,USD,-1,0.5,paid,EXCODE,EX-CODE_19371_USDda...,\n", buf.String())
+	})
+
+	t.Run("CancelledJSONLines", func(t *testing.T) {
+		var list []interface{}
+		for _, v := range decodeResponse(`{"list":[{"date":1435519742,"order_id":15,"order_type":"sell","pair":"BTC_USD","price":100,"quantity":3,"amount":300}]}`) {
+			list = v.([]interface{})
+		}
+		orders, err := ParseCancelledOrders(list)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, ExportCancelledOrders(&buf, FormatJSONLines, orders))
+		require.Equal(t, `{"order_id":"15","date":"2015-06-28T19:29:02Z","pair":"BTC_USD","type":"sell","quantity":"3","price":"100","amount":"300"}`+"\n", buf.String())
+	})
+
+	t.Run("RawDecimals", func(t *testing.T) {
+		// decimal strings of the exchange are exported as is, beyond float64 precision and with trailing zeros
+		parsed, err := parseTradeList(decodeResponse(`{"list":[{"trade_id":5,"date":1435488248,"type":"sell","pair":"BTC_RUB",
+			"order_id":9,"quantity":"0.10000000","price":"1234567.123456789012","amount":"123456.7123456789012",
+			"commission_amount":"493.82684938","commission_currency":"RUB","commission_percent":"0.40"}]}`)["list"].([]interface{}))
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, ExportTrades(&buf, FormatCSV, parsed))
+		require.Contains(t, buf.String(), ",0.10000000,1234567.123456789012,123456.7123456789012,,493.82684938,RUB,0.40\n")
+
+		operations, err := ParseWalletHistory(decodeResponse(`{"history":[
+			{"dt":1463414785,"type":"withdrawal","curr":"BTC","status":"paid","provider":"BTC","amount":"-0.123456789012345678","account":"","commission":"0.00050000"}]}`))
+		require.NoError(t, err)
+		buf.Reset()
+		require.NoError(t, ExportWalletHistory(&buf, FormatCSV, operations))
+		require.Contains(t, buf.String(), ",-0.123456789012345678,0.00050000,")
+
+		orders, err := ParseCancelledOrders(decodeResponse(`{"list":[{"date":1435519742,"order_id":15,"order_type":"sell","pair":"BTC_USD",
+			"price":"100.10","quantity":"3.000","amount":"300.3"}]}`)["list"].([]interface{}))
+		require.NoError(t, err)
+		buf.Reset()
+		require.NoError(t, ExportCancelledOrders(&buf, FormatCSV, orders))
+		require.Contains(t, buf.String(), ",3.000,100.10,300.3\n")
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		require.Error(t, ExportTrades(&bytes.Buffer{}, "xlsx", trades))
+	})
+}
+
+func TestAllCancelledOrders(t *testing.T) {
+	var offsets []string
+	api := stubApi(func(method string, params url.Values) string {
+		require.Equal(t, "user_cancelled_orders", method)
+		offsets = append(offsets, params.Get("offset"))
+		offset, _ := strconv.Atoi(params.Get("offset"))
+		count := 1000
+		if offset > 0 {
+			count = 5
+		}
+		var items []string
+		for i := 0; i < count; i++ {
+			id := offset + i
+			items = append(items, fmt.Sprintf(`{"date":%d,"order_id":%d,"order_type":"buy","pair":"BTC_RUB","price":100,"quantity":1,"amount":100}`, 1570000000-id, id))
+		}
+		return "[" + strings.Join(items, ",") + "]"
+	})
+
+	orders, err := api.AllCancelledOrders()
+	require.NoError(t, err)
+	require.Len(t, orders, 1005)
+	require.Equal(t, []string{"0", "1000"}, offsets)
+	require.Equal(t, int64(1004), orders[0].OrderId)
+
+	t.Run("Error", func(t *testing.T) {
+		api := stubApi(func(method string, params url.Values) string {
+			return `{"result":false,"error":"Error 40017: Wrong API Key"}`
+		})
+		_, err := api.GetUserCancelledOrders(0, 100)
+		require.EqualError(t, err, "Error 40017: Wrong API Key")
+	})
+}
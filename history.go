@@ -0,0 +1,348 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// UserTrade is a single user's deal.
+type UserTrade struct {
+	TradeId            int64
+	Date               time.Time
+	Type               string // buy or sell
+	Pair               string
+	OrderId            int64
+	ClientId           int64 // client order id, 0 if the order was created without it
+	Quantity           float64
+	Price              float64
+	Amount             float64
+	ExecType           string // maker or taker, if provided by the exchange
+	CommissionAmount   float64
+	CommissionCurrency string
+	CommissionPercent  float64
+	// Raw holds decimal strings of numeric fields as sent by the exchange, keyed by field name
+	// (quantity, price etc.). They are stored and exported instead of the float values.
+	Raw map[string]string
+}
+
+// WalletOperation is a single deposit or withdrawal from wallet history.
+type WalletOperation struct {
+	Date     time.Time
+	Type     string // deposit or withdrawal
+	Currency string
+	Status   string
+	Provider string
+	Amount   float64
+	Account  string
+	TxId     string
+	// Commission is the fee charged by the exchange, if provided
+	Commission float64
+	// Raw holds decimal strings of amount and commission as sent by the exchange. They are exported
+	// instead of the float values.
+	Raw map[string]string
+}
+
+// ParseUserTrades converts GetUserTrades response (trades grouped by pair) to typed trades ordered by trade id.
+func ParseUserTrades(resp ApiResponse) ([]UserTrade, error) {
+	var trades []UserTrade
+	for pair, value := range resp {
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("user trades for %s: unexpected format", pair)
+		}
+		parsed, err := parseTradeList(list)
+		if err != nil {
+			return nil, fmt.Errorf("user trades for %s: %s", pair, err)
+		}
+		trades = append(trades, parsed...)
+	}
+
+	sort.Slice(trades, func(i, j int) bool { return trades[i].TradeId < trades[j].TradeId })
+	return trades, nil
+}
+
+// parseTradeList converts list of trades as returned in user_trades and order_trades responses.
+func parseTradeList(list []interface{}) ([]UserTrade, error) {
+	trades := make([]UserTrade, 0, len(list))
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected trade format")
+		}
+
+		t := UserTrade{Raw: map[string]string{}}
+		var err error
+		var id, date, orderId, clientId float64
+		for key, dst := range map[string]*float64{
+			"trade_id":           &id,
+			"date":               &date,
+			"order_id":           &orderId,
+			"client_id":          &clientId,
+			"quantity":           &t.Quantity,
+			"price":              &t.Price,
+			"amount":             &t.Amount,
+			"commission_amount":  &t.CommissionAmount,
+			"commission_percent": &t.CommissionPercent,
+		} {
+			if v, ok := fields[key]; ok && v != nil {
+				if *dst, err = toFloat(v); err != nil {
+					return nil, fmt.Errorf("%s: %s", key, err)
+				}
+				keepDecimal(t.Raw, key, v)
+			}
+		}
+		t.TradeId = int64(id)
+		t.OrderId = int64(orderId)
+		t.ClientId = int64(clientId)
+		t.Date = time.Unix(int64(date), 0).UTC()
+		t.Type, _ = fields["type"].(string)
+		t.Pair, _ = fields["pair"].(string)
+		t.ExecType, _ = fields["exec_type"].(string)
+		t.CommissionCurrency, _ = fields["commission_currency"].(string)
+
+		trades = append(trades, t)
+	}
+	return trades, nil
+}
+
+// ParseWalletHistory converts GetWalletHistory response to typed operations.
+func ParseWalletHistory(resp ApiResponse) ([]WalletOperation, error) {
+	list, ok := resp["history"].([]interface{})
+	if !ok {
+		if resp["history"] == nil {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("wallet history: unexpected format")
+	}
+
+	operations := make([]WalletOperation, 0, len(list))
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("wallet history: unexpected operation format")
+		}
+
+		op := WalletOperation{Raw: map[string]string{}}
+		dt, err := toFloat(fields["dt"])
+		if err != nil {
+			return nil, fmt.Errorf("wallet history: dt: %s", err)
+		}
+		op.Date = time.Unix(int64(dt), 0).UTC()
+		if op.Amount, err = toFloat(fields["amount"]); err != nil {
+			return nil, fmt.Errorf("wallet history: amount: %s", err)
+		}
+		keepDecimal(op.Raw, "amount", fields["amount"])
+		if v, ok := fields["commission"]; ok && v != nil {
+			if op.Commission, err = toFloat(v); err != nil {
+				return nil, fmt.Errorf("wallet history: commission: %s", err)
+			}
+			keepDecimal(op.Raw, "commission", v)
+		}
+		op.Type, _ = fields["type"].(string)
+		op.Currency, _ = fields["curr"].(string)
+		op.Status, _ = fields["status"].(string)
+		op.Provider, _ = fields["provider"].(string)
+		op.Account, _ = fields["account"].(string)
+		op.TxId, _ = fields["txid"].(string)
+
+		operations = append(operations, op)
+	}
+	return operations, nil
+}
+
+// keepDecimal saves the value of the field if it was sent as a decimal string.
+func keepDecimal(raw map[string]string, key string, v interface{}) {
+	if s, ok := v.(string); ok && s != "" {
+		raw[key] = s
+	}
+}
+
+// decimal returns the decimal string of the field as sent by the exchange, or the formatted value
+// if it wasn't kept.
+func decimal(raw map[string]string, key string, value float64) string {
+	if s, ok := raw[key]; ok {
+		return s
+	}
+	return formatFloat(value)
+}
+
+// maxUserTradesLimit is the maximal page size accepted by user_trades method.
+const maxUserTradesLimit = 1000
+
+// UserTradesIterator walks all pages of user trades pair by pair, newest trades first.
+//
+//	it := api.IterateUserTrades(ctx, []string{"BTC_RUB", "ETH_RUB"}, 1000)
+//	for it.Next() {
+//		trade := it.Trade()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type UserTradesIterator struct {
+	ex       *Exmo
+	ctx      context.Context
+	pairs    []string
+	pageSize int
+	offset   int
+	page     []UserTrade
+	current  UserTrade
+	last     bool // current page is the last one of the pair
+	err      error
+}
+
+// IterateUserTrades returns iterator over all user trades of the pairs. Requests go through the client's
+// rate limiter and stop when the context is done. Page size is limited to 1000.
+func (ex *Exmo) IterateUserTrades(ctx context.Context, pairs []string, pageSize int) *UserTradesIterator {
+	if pageSize <= 0 || pageSize > maxUserTradesLimit {
+		pageSize = maxUserTradesLimit
+	}
+	return &UserTradesIterator{ex: ex, ctx: ctx, pairs: pairs, pageSize: pageSize}
+}
+
+// Next advances to the next trade, requesting the next page when needed. It returns false when
+// all trades are read or an error occurred.
+func (it *UserTradesIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || len(it.pairs) == 0 {
+			return false
+		}
+		if it.last {
+			it.pairs = it.pairs[1:]
+			it.offset = 0
+			it.last = false
+			continue
+		}
+		if it.err = it.ctx.Err(); it.err != nil {
+			return false
+		}
+
+		page, err := it.ex.userTradesPage(it.ctx, it.pairs[0], it.offset, it.pageSize)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page
+		it.offset += len(page)
+		it.last = len(page) < it.pageSize
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// userTradesPage requests a single page of user trades of the pair, newest first.
+func (ex *Exmo) userTradesPage(ctx context.Context, pair string, offset, limit int) ([]UserTrade, error) {
+	resp, err := ex.Api_queryContext(ctx, "authenticated", "user_trades", ApiParams{
+		"pair":   pair,
+		"offset": strconv.Itoa(offset),
+		"limit":  strconv.Itoa(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	list, _ := resp[pair].([]interface{})
+	trades, err := parseTradeList(list)
+	if err != nil {
+		return nil, fmt.Errorf("user trades for %s: %s", pair, err)
+	}
+	return trades, nil
+}
+
+// Trade returns the current trade.
+func (it *UserTradesIterator) Trade() UserTrade {
+	return it.current
+}
+
+// Err returns the error that stopped iteration, if any.
+func (it *UserTradesIterator) Err() error {
+	return it.err
+}
+
+// WalletHistoryIterator walks wallet history day by day.
+type WalletHistoryIterator struct {
+	ex      *Exmo
+	ctx     context.Context
+	day     time.Time
+	from    time.Time
+	to      time.Time
+	page    []WalletOperation
+	current WalletOperation
+	err     error
+}
+
+// IterateWalletHistory returns iterator over wallet operations made in [from, to] requesting one day at a time.
+// Requests go through the client's rate limiter and stop when the context is done.
+func (ex *Exmo) IterateWalletHistory(ctx context.Context, from, to time.Time) *WalletHistoryIterator {
+	from, to = from.UTC(), to.UTC()
+	return &WalletHistoryIterator{
+		ex:   ex,
+		ctx:  ctx,
+		day:  time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC),
+		from: from,
+		to:   to,
+	}
+}
+
+// Next advances to the next operation, requesting the next day when needed. It returns false when
+// the range is exhausted or an error occurred.
+func (it *WalletHistoryIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.day.After(it.to) {
+			return false
+		}
+		if it.err = it.ctx.Err(); it.err != nil {
+			return false
+		}
+
+		resp, err := it.ex.Api_queryContext(it.ctx, "authenticated", "wallet_history", ApiParams{
+			"date": strconv.FormatInt(it.day.Unix(), 10),
+		})
+		if err != nil {
+			it.err = err
+			return false
+		}
+		operations, err := ParseWalletHistory(resp)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		for _, op := range operations {
+			if !op.Date.Before(it.from) && !op.Date.After(it.to) {
+				it.page = append(it.page, op)
+			}
+		}
+		sort.SliceStable(it.page, func(i, j int) bool { return it.page[i].Date.Before(it.page[j].Date) })
+		it.day = it.day.AddDate(0, 0, 1)
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Operation returns the current operation.
+func (it *WalletHistoryIterator) Operation() WalletOperation {
+	return it.current
+}
+
+// Err returns the error that stopped iteration, if any.
+func (it *WalletHistoryIterator) Err() error {
+	return it.err
+}
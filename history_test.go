@@ -0,0 +1,139 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// tradesJSON renders user trades with ids in [from, to) for the pair, newest first as the exchange does.
+func tradesJSON(pair string, from, to int) string {
+	var items []string
+	for id := to - 1; id >= from; id-- {
+		items = append(items, fmt.Sprintf(`{"trade_id":%d,"date":%d,"type":"buy","pair":"%s","order_id":%d,`+
+			`"quantity":"0.01","price":"1000000","amount":"10000","exec_type":"taker",`+
+			`"commission_amount":"0.00004","commission_currency":"BTC","commission_percent":"0.4"}`,
+			id, 1570000000+id, pair, id*10))
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+// stubUserTrades serves user_trades pages from total trades per pair.
+func stubUserTrades(total map[string]int, requests *[]string) func(method string, params url.Values) string {
+	return func(method string, params url.Values) string {
+		pair := params.Get("pair")
+		offset, _ := strconv.Atoi(params.Get("offset"))
+		limit, _ := strconv.Atoi(params.Get("limit"))
+		if requests != nil {
+			*requests = append(*requests, fmt.Sprintf("%s:%d", pair, offset))
+		}
+		to := total[pair] - offset
+		from := to - limit
+		if from < 0 {
+			from = 0
+		}
+		return `{"` + pair + `":` + tradesJSON(pair, from, to) + `}`
+	}
+}
+
+func TestParseUserTrades(t *testing.T) {
+	resp := decodeResponse(`{"BTC_RUB":` + tradesJSON("BTC_RUB", 3, 5) + `,"ETH_RUB":` + tradesJSON("ETH_RUB", 1, 3) + `}`)
+	trades, err := ParseUserTrades(resp)
+	require.NoError(t, err)
+	require.Len(t, trades, 4)
+	require.Equal(t, int64(1), trades[0].TradeId)
+	require.Equal(t, UserTrade{
+		TradeId: 4, Date: time.Unix(1570000004, 0).UTC(), Type: "buy", Pair: "BTC_RUB", OrderId: 40,
+		Quantity: 0.01, Price: 1000000, Amount: 10000, ExecType: "taker",
+		CommissionAmount: 0.00004, CommissionCurrency: "BTC", CommissionPercent: 0.4,
+		Raw: map[string]string{"quantity": "0.01", "price": "1000000", "amount": "10000",
+			"commission_amount": "0.00004", "commission_percent": "0.4"},
+	}, trades[3])
+}
+
+func TestIterateUserTrades(t *testing.T) {
+	var requests []string
+	api := stubApi(stubUserTrades(map[string]int{"BTC_RUB": 25, "ETH_RUB": 10}, &requests))
+
+	it := api.IterateUserTrades(context.Background(), []string{"BTC_RUB", "ETH_RUB"}, 10)
+	seen := map[string]int{}
+	for it.Next() {
+		seen[it.Trade().Pair]++
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, map[string]int{"BTC_RUB": 25, "ETH_RUB": 10}, seen)
+	require.Equal(t, []string{"BTC_RUB:0", "BTC_RUB:10", "BTC_RUB:20", "ETH_RUB:0", "ETH_RUB:10"}, requests)
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		it := api.IterateUserTrades(ctx, []string{"BTC_RUB"}, 10)
+		require.True(t, it.Next())
+		cancel()
+		for it.Next() {
+		}
+		require.Equal(t, context.Canceled, it.Err())
+	})
+
+	t.Run("RateLimited", func(t *testing.T) {
+		api := stubApi(stubUserTrades(map[string]int{"BTC_RUB": 30}, nil), WithRateLimit(20))
+		start := time.Now()
+		it := api.IterateUserTrades(context.Background(), []string{"BTC_RUB"}, 10)
+		for it.Next() {
+		}
+		require.NoError(t, it.Err())
+		// 4 requests at 20 per second
+		require.True(t, time.Since(start) >= 140*time.Millisecond)
+	})
+}
+
+func TestIterateWalletHistory(t *testing.T) {
+	var days []int64
+	api := stubApi(func(method string, params url.Values) string {
+		date, _ := strconv.ParseInt(params.Get("date"), 10, 64)
+		days = append(days, date)
+		return fmt.Sprintf(`{"result":true,"error":"","begin":"%d","end":"%d","history":[
+			{"dt":%d,"type":"withdrawal","curr":"BTC","status":"paid","provider":"BTC","amount":"0.1","account":"addr"},
+			{"dt":%d,"type":"deposit","curr":"RUB","status":"processing","provider":"Qiwi","amount":"1000","account":""}]}`,
+			date, date+86400, date+3600*20, date+3600)
+	})
+
+	from := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2019, 10, 3, 12, 0, 0, 0, time.UTC)
+	it := api.IterateWalletHistory(context.Background(), from, to)
+	var operations []WalletOperation
+	for it.Next() {
+		operations = append(operations, it.Operation())
+	}
+	require.NoError(t, it.Err())
+	require.Len(t, days, 3)
+	require.Equal(t, time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC).Unix(), days[0])
+
+	// 01.10 01:00 and 03.10 20:00 are out of range
+	require.Len(t, operations, 4)
+	require.Equal(t, time.Date(2019, 10, 1, 20, 0, 0, 0, time.UTC), operations[0].Date)
+	require.Equal(t, "withdrawal", operations[0].Type)
+	require.Equal(t, 0.1, operations[0].Amount)
+	require.Equal(t, "deposit", operations[1].Type)
+}
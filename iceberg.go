@@ -0,0 +1,313 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// IcebergParams describes a large limit order shown to the market in small slices.
+type IcebergParams struct {
+	Pair     string
+	Side     string  // buy or sell
+	Quantity float64 // total quantity in base currency
+	Price    float64 // limit price
+	Visible  float64 // quantity of a single slice
+
+	// SizeJitter randomizes slice size by up to the fraction of Visible in both directions, e.g. 0.2 for ±20%.
+	SizeJitter float64
+	// PriceJitterTicks moves slice price by a random number of ticks (up to the value) away from the market,
+	// so the price is never worse than Price.
+	PriceJitterTicks int
+	// PollInterval is the pause between order tracker polls, 1 second by default.
+	PollInterval time.Duration
+	// MaxPollErrors is the number of consecutive failed order tracker polls after which the iceberg fails,
+	// 5 by default.
+	MaxPollErrors int
+}
+
+// IcebergSlice is a visible limit order placed by the iceberg.
+type IcebergSlice struct {
+	OrderId  string
+	Quantity string
+	Price    string
+	Filled   float64
+	State    OrderState
+}
+
+// IcebergReport is the parent fill report of the iceberg.
+type IcebergReport struct {
+	Pair      string
+	Side      string
+	Quantity  float64
+	Filled    float64
+	Remaining float64
+	Slices    []IcebergSlice
+	State     AlgoState // AlgoRunning or one of the final states
+	Err       error
+	// Resting is the id of the slice that may be left in the book: the iceberg failed and couldn't cancel it.
+	Resting string
+}
+
+// Iceberg keeps one slice of a large limit order in the book and replaces it with the next one
+// when the order tracker reports it filled. It is safe for concurrent use.
+type Iceberg struct {
+	trader   Trader
+	settings PairSettings
+	params   IcebergParams
+	tracker  *OrderTracker
+	rnd      *rand.Rand
+
+	mu     sync.Mutex
+	report IcebergReport
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartIceberg places the first slice and keeps replenishing it until the total quantity is filled,
+// the context is done or Cancel is called.
+func StartIceberg(ctx context.Context, trader Trader, market MarketData, params IcebergParams) (*Iceberg, error) {
+	if params.Side != "buy" && params.Side != "sell" {
+		return nil, fmt.Errorf("invalid side %q", params.Side)
+	}
+	if params.Quantity <= 0 || params.Visible <= 0 || params.Price <= 0 {
+		return nil, fmt.Errorf("quantity, visible quantity and price must be positive")
+	}
+	if params.SizeJitter < 0 || params.SizeJitter >= 1 {
+		return nil, fmt.Errorf("size jitter must be in [0, 1)")
+	}
+	if params.PollInterval <= 0 {
+		params.PollInterval = time.Second
+	}
+	if params.MaxPollErrors <= 0 {
+		params.MaxPollErrors = 5
+	}
+	resp, err := market.GetPairSettings()
+	if err != nil {
+		return nil, err
+	}
+	settings, err := ParsePairSettings(resp)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := settings[params.Pair]
+	if !ok {
+		return nil, fmt.Errorf("unknown currency pair %s", params.Pair)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ice := &Iceberg{
+		trader:   trader,
+		settings: s,
+		params:   params,
+		tracker:  NewOrderTracker(trader),
+		rnd:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		report:   IcebergReport{Pair: params.Pair, Side: params.Side, Quantity: params.Quantity, Remaining: params.Quantity},
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go ice.run(ctx)
+	return ice, nil
+}
+
+// Cancel stops the iceberg and cancels the slice resting in the book.
+func (ice *Iceberg) Cancel() {
+	ice.cancel()
+}
+
+// Done is closed when the iceberg reaches the final state.
+func (ice *Iceberg) Done() <-chan struct{} {
+	return ice.done
+}
+
+// Wait blocks until the iceberg reaches the final state and returns the report.
+func (ice *Iceberg) Wait() IcebergReport {
+	<-ice.done
+	return ice.Report()
+}
+
+// Report returns the current state of the iceberg.
+func (ice *Iceberg) Report() IcebergReport {
+	ice.mu.Lock()
+	defer ice.mu.Unlock()
+	r := ice.report
+	r.Slices = append([]IcebergSlice(nil), r.Slices...)
+	return r
+}
+
+func (ice *Iceberg) run(ctx context.Context) {
+	defer close(ice.done)
+	defer ice.cancel()
+
+	for {
+		ice.mu.Lock()
+		remaining := ice.report.Remaining
+		ice.mu.Unlock()
+		if remaining < ice.settings.MinQuantity || remaining <= epsilon {
+			ice.finish(AlgoCompleted, nil)
+			return
+		}
+
+		slice, err := ice.place(remaining)
+		if err != nil {
+			ice.finish(AlgoFailed, err)
+			return
+		}
+
+		state, err := ice.follow(ctx, slice)
+		switch {
+		case err != nil:
+			ice.abandon(slice)
+			ice.finish(AlgoFailed, err)
+			return
+		case ctx.Err() != nil:
+			ice.finish(AlgoCancelled, nil)
+			return
+		case state == OrderCancelled:
+			ice.finish(AlgoFailed, fmt.Errorf("slice %s was cancelled outside of the iceberg", slice.OrderId))
+			return
+		}
+	}
+}
+
+// place sends the next slice.
+func (ice *Iceberg) place(remaining float64) (IcebergSlice, error) {
+	size := ice.params.Visible
+	if ice.params.SizeJitter > 0 {
+		size *= 1 + ice.params.SizeJitter*(2*ice.rnd.Float64()-1)
+	}
+	if size < ice.settings.MinQuantity {
+		size = ice.settings.MinQuantity
+	}
+	// don't leave a remainder too small to be placed
+	if size > remaining || remaining-size < ice.settings.MinQuantity {
+		size = remaining
+	}
+
+	price := ice.params.Price
+	if ice.params.PriceJitterTicks > 0 {
+		offset := float64(ice.rnd.Intn(ice.params.PriceJitterTicks+1)) * ice.settings.PriceTick()
+		if ice.params.Side == "buy" {
+			price -= offset
+		} else {
+			price += offset
+		}
+	}
+
+	mode := RoundUp
+	if ice.params.Side == "buy" {
+		mode = RoundDown
+	}
+	slice := IcebergSlice{Quantity: ice.settings.RoundQuantity(size, RoundDown), Price: ice.settings.RoundPrice(price, mode)}
+	resp, err := ice.trader.OrderCreate(ice.params.Pair, slice.Quantity, slice.Price, ice.params.Side)
+	if err != nil {
+		return slice, err
+	}
+	if slice.OrderId, err = orderIdOf(resp); err != nil {
+		return slice, err
+	}
+
+	q, _ := strconv.ParseFloat(slice.Quantity, 64)
+	ice.tracker.Track(slice.OrderId, ice.params.Pair, q)
+	ice.mu.Lock()
+	ice.report.Slices = append(ice.report.Slices, slice)
+	ice.mu.Unlock()
+	return slice, nil
+}
+
+// follow polls the slice until it reaches the final state. When the context is done the slice is cancelled.
+// Failed polls are retried up to MaxPollErrors times in a row.
+func (ice *Iceberg) follow(ctx context.Context, slice IcebergSlice) (OrderState, error) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	cancelled, attempts, failures := false, 0, 0
+	for {
+		if !cancelled {
+			select {
+			case <-ctx.Done():
+				if _, err := ice.trader.OrderCancel(slice.OrderId); err != nil && !isOrderNotFound(err) {
+					return OrderOpen, err
+				}
+				cancelled = true
+			case <-timer.C:
+			}
+		}
+
+		events, err := ice.tracker.Poll()
+		for _, e := range events {
+			ice.update(e)
+			if e.State.Final() {
+				return e.State, nil
+			}
+		}
+		if err != nil {
+			if failures++; failures >= ice.params.MaxPollErrors {
+				return OrderOpen, err
+			}
+		} else {
+			failures = 0
+		}
+		if cancelled {
+			// wait for the cancel to show up without blocking on the done context
+			if attempts++; attempts >= 5 {
+				return OrderOpen, fmt.Errorf("slice %s is still open after cancel", slice.OrderId)
+			}
+			time.Sleep(ice.params.PollInterval)
+			continue
+		}
+		timer.Reset(ice.params.PollInterval)
+	}
+}
+
+// update applies the tracker event to the last slice and the parent report.
+func (ice *Iceberg) update(e OrderEvent) {
+	ice.mu.Lock()
+	defer ice.mu.Unlock()
+
+	slice := &ice.report.Slices[len(ice.report.Slices)-1]
+	ice.report.Filled += e.Filled - slice.Filled
+	slice.Filled, slice.State = e.Filled, e.State
+	ice.report.Remaining = ice.report.Quantity - ice.report.Filled
+	if ice.report.Remaining < 0 {
+		ice.report.Remaining = 0
+	}
+}
+
+// abandon cancels the slice the iceberg can't follow anymore. If it can't be cancelled, its id is reported
+// as resting.
+func (ice *Iceberg) abandon(slice IcebergSlice) {
+	ice.tracker.Untrack(slice.OrderId)
+	if _, err := ice.trader.OrderCancel(slice.OrderId); err == nil || isOrderNotFound(err) {
+		return
+	}
+	ice.mu.Lock()
+	ice.report.Resting = slice.OrderId
+	ice.mu.Unlock()
+}
+
+func (ice *Iceberg) finish(state AlgoState, err error) {
+	ice.mu.Lock()
+	defer ice.mu.Unlock()
+	ice.report.State = state
+	ice.report.Err = err
+}
@@ -0,0 +1,210 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncingPaper matches resting orders against the current book every time open orders are requested.
+type syncingPaper struct {
+	*Paper
+	mu     sync.Mutex
+	market *stubMarket
+
+	openErrors int   // number of the next open orders requests that fail, -1 to fail all
+	cancelErr  error // error of order cancel requests
+}
+
+func (p *syncingPaper) fail(openErrors int, cancelErr error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.openErrors, p.cancelErr = openErrors, cancelErr
+}
+
+func (p *syncingPaper) OrderCancel(orderId string) (ApiResponse, error) {
+	p.mu.Lock()
+	err := p.cancelErr
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return p.Paper.OrderCancel(orderId)
+}
+
+func (p *syncingPaper) setBook(pair, book string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.market.books[pair] = book
+}
+
+func (p *syncingPaper) GetUserOpenOrders() (ApiResponse, error) {
+	p.mu.Lock()
+	if p.openErrors != 0 {
+		if p.openErrors > 0 {
+			p.openErrors--
+		}
+		p.mu.Unlock()
+		return nil, errors.New("connection reset")
+	}
+	err := p.Sync()
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return p.Paper.GetUserOpenOrders()
+}
+
+func (p *syncingPaper) OrderCreate(pair string, quantity string, price string, typeOrder string) (ApiResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.Paper.OrderCreate(pair, quantity, price, typeOrder)
+}
+
+func TestIceberg(t *testing.T) {
+	params := IcebergParams{Pair: "BTC_RUB", Side: "sell", Quantity: 1, Price: 1050000, Visible: 0.3, PollInterval: time.Millisecond}
+
+	t.Run("Replenish", func(t *testing.T) {
+		market := newStubMarket()
+		p := &syncingPaper{Paper: NewPaper(market, map[string]float64{"BTC": 1}), market: market}
+		ice, err := StartIceberg(context.Background(), p, market, params)
+		require.NoError(t, err)
+
+		// only one slice is visible while the market is below the price
+		time.Sleep(20 * time.Millisecond)
+		report := ice.Report()
+		require.Len(t, report.Slices, 1)
+		require.Equal(t, "0.3", report.Slices[0].Quantity)
+		require.InDelta(t, 0.7, paperBalance(t, p.Paper, "balances", "BTC"), 1e-12)
+
+		p.setBook("BTC_RUB", `{"ask":[["1110000","1","1110000"]],"bid":[["1100000","10","11000000"]]}`)
+		report = ice.Wait()
+		require.Equal(t, AlgoCompleted, report.State)
+		require.InDelta(t, 1, report.Filled, 1e-12)
+		var sizes []string
+		for _, slice := range report.Slices {
+			sizes = append(sizes, slice.Quantity)
+		}
+		require.Equal(t, []string{"0.3", "0.3", "0.3", "0.1"}, sizes)
+		for _, slice := range report.Slices {
+			require.Equal(t, OrderFilled, slice.State)
+			require.Equal(t, "1050000", slice.Price)
+		}
+	})
+
+	t.Run("Randomized", func(t *testing.T) {
+		market := newStubMarket()
+		market.books["BTC_RUB"] = `{"ask":[["1110000","1","1110000"]],"bid":[["1100000","10","11000000"]]}`
+		p := &syncingPaper{Paper: NewPaper(market, map[string]float64{"BTC": 1}), market: market}
+		random := params
+		random.Price, random.SizeJitter, random.PriceJitterTicks = 1000000, 0.5, 5
+		ice, err := StartIceberg(context.Background(), p, market, random)
+		require.NoError(t, err)
+
+		report := ice.Wait()
+		require.Equal(t, AlgoCompleted, report.State)
+		require.InDelta(t, 1, report.Filled, 1e-12)
+		for i, slice := range report.Slices {
+			q, _ := strconv.ParseFloat(slice.Quantity, 64)
+			price, _ := strconv.ParseFloat(slice.Price, 64)
+			require.True(t, price >= 1000000 && price <= 1000000.05, slice.Price)
+			if i < len(report.Slices)-1 {
+				require.True(t, q >= 0.15 && q <= 0.45, slice.Quantity)
+			}
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		market := newStubMarket()
+		p := &syncingPaper{Paper: NewPaper(market, map[string]float64{"BTC": 1}), market: market}
+		ice, err := StartIceberg(context.Background(), p, market, params)
+		require.NoError(t, err)
+
+		for len(ice.Report().Slices) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		ice.Cancel()
+		report := ice.Wait()
+		require.Equal(t, AlgoCancelled, report.State)
+		require.Equal(t, OrderCancelled, report.Slices[0].State)
+
+		open, _ := p.GetUserOpenOrders()
+		require.Empty(t, open)
+		require.InDelta(t, 1, paperBalance(t, p.Paper, "balances", "BTC"), 1e-12)
+	})
+	t.Run("PollErrors", func(t *testing.T) {
+		market := newStubMarket()
+		p := &syncingPaper{Paper: NewPaper(market, map[string]float64{"BTC": 1}), market: market}
+		ice, err := StartIceberg(context.Background(), p, market, params)
+		require.NoError(t, err)
+		for len(ice.Report().Slices) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// transient errors are retried
+		p.fail(3, nil)
+		p.setBook("BTC_RUB", `{"ask":[["1110000","1","1110000"]],"bid":[["1100000","10","11000000"]]}`)
+		report := ice.Wait()
+		require.Equal(t, AlgoCompleted, report.State)
+		require.InDelta(t, 1, report.Filled, 1e-12)
+		require.Empty(t, report.Resting)
+	})
+
+	t.Run("PollFailed", func(t *testing.T) {
+		market := newStubMarket()
+		p := &syncingPaper{Paper: NewPaper(market, map[string]float64{"BTC": 1}), market: market}
+		ice, err := StartIceberg(context.Background(), p, market, params)
+		require.NoError(t, err)
+		for len(ice.Report().Slices) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// the slice is cancelled when the iceberg can't follow it
+		p.fail(-1, nil)
+		report := ice.Wait()
+		require.Equal(t, AlgoFailed, report.State)
+		require.Error(t, report.Err)
+		require.Empty(t, report.Resting)
+		open, err := p.Paper.GetUserOpenOrders()
+		require.NoError(t, err)
+		require.Empty(t, open)
+		require.InDelta(t, 1, paperBalance(t, p.Paper, "balances", "BTC"), 1e-12)
+	})
+
+	t.Run("PollFailedResting", func(t *testing.T) {
+		market := newStubMarket()
+		p := &syncingPaper{Paper: NewPaper(market, map[string]float64{"BTC": 1}), market: market}
+		ice, err := StartIceberg(context.Background(), p, market, params)
+		require.NoError(t, err)
+		for len(ice.Report().Slices) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		// the slice that couldn't be cancelled is reported
+		p.fail(-1, errors.New("connection reset"))
+		report := ice.Wait()
+		require.Equal(t, AlgoFailed, report.State)
+		require.Equal(t, report.Slices[0].OrderId, report.Resting)
+	})
+}
@@ -0,0 +1,311 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package ledger builds double-entry journal of EXMO account from user trades and wallet history
+// and reconciles expected balances with the balances reported by the exchange.
+//
+// Every entry balances to zero in each currency. Exchange holdings are kept in AccountAssets,
+// the other side of trades goes to AccountTrading, of deposits and withdrawals to AccountTransfers
+// and of commissions to AccountFees.
+package ledger
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vadiminshakov/exmo"
+)
+
+// Accounts of the journal.
+const (
+	AccountAssets    = "assets:exmo"
+	AccountTrading   = "equity:trading"
+	AccountTransfers = "equity:transfers"
+	AccountOpening   = "equity:opening"
+	AccountFees      = "expenses:fees"
+)
+
+// epsilon is the tolerance of entry balancing.
+const epsilon = 1e-9
+
+// Posting is a change of an account in a single currency.
+type Posting struct {
+	Account  string
+	Currency string
+	Amount   float64 // positive is debit, negative is credit
+}
+
+// Entry is a balanced journal entry.
+type Entry struct {
+	Date        time.Time
+	Ref         string // unique reference of the source record, e.g. trade:123
+	Description string
+	Postings    []Posting
+}
+
+// Ledger is a journal of entries. It is not safe for concurrent use.
+type Ledger struct {
+	entries []Entry
+	refs    map[string]bool
+}
+
+// New creates empty ledger.
+func New() *Ledger {
+	return &Ledger{refs: map[string]bool{}}
+}
+
+// Post adds entry to the journal. Entries with already posted Ref are skipped.
+// Entry that doesn't balance to zero in every currency is rejected.
+func (l *Ledger) Post(e Entry) error {
+	if e.Ref != "" && l.refs[e.Ref] {
+		return nil
+	}
+
+	sums := map[string]float64{}
+	for _, p := range e.Postings {
+		sums[p.Currency] += p.Amount
+	}
+	for currency, sum := range sums {
+		if math.Abs(sum) > epsilon {
+			return fmt.Errorf("entry %s doesn't balance in %s: %v", e.Ref, currency, sum)
+		}
+	}
+
+	if e.Ref != "" {
+		l.refs[e.Ref] = true
+	}
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+// AddOpening posts opening balances (currency -> amount) held before the history starts.
+func (l *Ledger) AddOpening(date time.Time, balances map[string]float64) error {
+	e := Entry{Date: date, Ref: "opening:" + date.UTC().Format(time.RFC3339), Description: "opening balances"}
+	for _, currency := range sortedKeys(balances) {
+		e.Postings = append(e.Postings,
+			Posting{AccountAssets, currency, balances[currency]},
+			Posting{AccountOpening, currency, -balances[currency]},
+		)
+	}
+	return l.Post(e)
+}
+
+// AddTrades posts user trades. Commission is charged in the currency it is reported in.
+func (l *Ledger) AddTrades(trades ...exmo.UserTrade) error {
+	for _, t := range trades {
+		base, quote, err := exmo.SplitPair(t.Pair)
+		if err != nil {
+			return err
+		}
+
+		e := Entry{
+			Date:        t.Date,
+			Ref:         fmt.Sprintf("trade:%d", t.TradeId),
+			Description: fmt.Sprintf("%s %v %s at %v", t.Type, t.Quantity, t.Pair, t.Price),
+		}
+		switch t.Type {
+		case "buy":
+			e.Postings = []Posting{
+				{AccountAssets, base, t.Quantity},
+				{AccountTrading, base, -t.Quantity},
+				{AccountAssets, quote, -t.Amount},
+				{AccountTrading, quote, t.Amount},
+			}
+		case "sell":
+			e.Postings = []Posting{
+				{AccountAssets, base, -t.Quantity},
+				{AccountTrading, base, t.Quantity},
+				{AccountAssets, quote, t.Amount},
+				{AccountTrading, quote, -t.Amount},
+			}
+		default:
+			return fmt.Errorf("trade %d: unknown type %q", t.TradeId, t.Type)
+		}
+		if t.CommissionAmount != 0 && t.CommissionCurrency != "" {
+			e.Postings = append(e.Postings,
+				Posting{AccountFees, t.CommissionCurrency, t.CommissionAmount},
+				Posting{AccountAssets, t.CommissionCurrency, -t.CommissionAmount},
+			)
+		}
+
+		if err := l.Post(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddWalletOperations posts deposits and withdrawals. Cancelled and failed operations are skipped,
+// as well as deposits that are not credited yet.
+func (l *Ledger) AddWalletOperations(operations ...exmo.WalletOperation) error {
+	for _, op := range operations {
+		status := strings.ToLower(op.Status)
+		if status == "cancelled" || status == "canceled" || status == "error" || status == "failed" {
+			continue
+		}
+
+		amount := math.Abs(op.Amount)
+		e := Entry{
+			Date:        op.Date,
+			Ref:         fmt.Sprintf("wallet:%s:%d:%s:%s:%s%s", op.Type, op.Date.Unix(), op.Currency, formatAmount(op.Amount), op.Account, op.TxId),
+			Description: fmt.Sprintf("%s %v %s via %s", op.Type, amount, op.Currency, op.Provider),
+		}
+		switch op.Type {
+		case "deposit":
+			if status == "processing" {
+				continue
+			}
+			e.Postings = []Posting{
+				{AccountAssets, op.Currency, amount},
+				{AccountTransfers, op.Currency, -amount},
+			}
+		case "withdrawal":
+			e.Postings = []Posting{
+				{AccountAssets, op.Currency, -amount},
+				{AccountTransfers, op.Currency, amount},
+			}
+		default:
+			return fmt.Errorf("wallet operation at %s: unknown type %q", op.Date, op.Type)
+		}
+		if op.Commission != 0 {
+			e.Postings = append(e.Postings,
+				Posting{AccountFees, op.Currency, op.Commission},
+				Posting{AccountAssets, op.Currency, -op.Commission},
+			)
+		}
+
+		if err := l.Post(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entries returns posted entries ordered by date.
+func (l *Ledger) Entries() []Entry {
+	entries := append([]Entry(nil), l.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Date.Before(entries[j].Date) })
+	return entries
+}
+
+// Balance returns balance of the account by currency.
+func (l *Ledger) Balance(account string) map[string]float64 {
+	balance := map[string]float64{}
+	for _, e := range l.entries {
+		for _, p := range e.Postings {
+			if p.Account == account {
+				balance[p.Currency] += p.Amount
+			}
+		}
+	}
+	return balance
+}
+
+// ExpectedBalances returns holdings on the exchange by currency according to the journal.
+func (l *Ledger) ExpectedBalances() map[string]float64 {
+	return l.Balance(AccountAssets)
+}
+
+// Discrepancy is a difference between expected and actual holdings of a currency.
+type Discrepancy struct {
+	Currency   string
+	Expected   float64
+	Balance    float64 // available, from balances
+	Reserved   float64 // in open orders, from reserved
+	Actual     float64 // Balance + Reserved
+	Difference float64 // Actual - Expected
+}
+
+// Reconcile compares expected balances with GetUserInfo response and returns currencies whose
+// actual holdings (balances plus reserved) differ from expected by more than tolerance.
+func (l *Ledger) Reconcile(userInfo exmo.ApiResponse, tolerance float64) ([]Discrepancy, error) {
+	balances, err := parseAmounts(userInfo["balances"])
+	if err != nil {
+		return nil, fmt.Errorf("balances: %s", err)
+	}
+	reserved, err := parseAmounts(userInfo["reserved"])
+	if err != nil {
+		return nil, fmt.Errorf("reserved: %s", err)
+	}
+	expected := l.ExpectedBalances()
+
+	currencies := map[string]float64{}
+	for _, m := range []map[string]float64{expected, balances, reserved} {
+		for currency := range m {
+			currencies[currency] = 0
+		}
+	}
+
+	var discrepancies []Discrepancy
+	for _, currency := range sortedKeys(currencies) {
+		d := Discrepancy{
+			Currency: currency,
+			Expected: expected[currency],
+			Balance:  balances[currency],
+			Reserved: reserved[currency],
+		}
+		d.Actual = d.Balance + d.Reserved
+		d.Difference = d.Actual - d.Expected
+		if math.Abs(d.Difference) > tolerance {
+			discrepancies = append(discrepancies, d)
+		}
+	}
+	return discrepancies, nil
+}
+
+func parseAmounts(value interface{}) (map[string]float64, error) {
+	amounts := map[string]float64{}
+	if value == nil {
+		return amounts, nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected format")
+	}
+	for currency, v := range fields {
+		var amount float64
+		var err error
+		switch val := v.(type) {
+		case string:
+			if amount, err = strconv.ParseFloat(val, 64); err != nil {
+				return nil, fmt.Errorf("%s: %s", currency, err)
+			}
+		case float64:
+			amount = val
+		default:
+			return nil, fmt.Errorf("%s: unexpected value %#v", currency, v)
+		}
+		amounts[currency] = amount
+	}
+	return amounts, nil
+}
+
+func formatAmount(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
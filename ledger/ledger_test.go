@@ -0,0 +1,92 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vadiminshakov/exmo"
+)
+
+func day(d int) time.Time {
+	return time.Date(2019, 10, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestLedger(t *testing.T) {
+	l := New()
+
+	require.NoError(t, l.AddWalletOperations(
+		exmo.WalletOperation{Date: day(1), Type: "deposit", Currency: "RUB", Status: "paid", Amount: 200000},
+		exmo.WalletOperation{Date: day(2), Type: "deposit", Currency: "RUB", Status: "processing", Amount: 5000},
+		exmo.WalletOperation{Date: day(2), Type: "withdrawal", Currency: "RUB", Status: "cancelled", Amount: -1000},
+		exmo.WalletOperation{Date: day(5), Type: "withdrawal", Currency: "BTC", Status: "paid", Amount: -0.05, Commission: 0.0005, TxId: "tx1"},
+	))
+	require.NoError(t, l.AddTrades(
+		exmo.UserTrade{TradeId: 1, Date: day(3), Type: "buy", Pair: "BTC_RUB", Quantity: 0.1, Price: 1000000, Amount: 100000,
+			CommissionAmount: 0.0004, CommissionCurrency: "BTC"},
+		exmo.UserTrade{TradeId: 2, Date: day(4), Type: "sell", Pair: "BTC_RUB", Quantity: 0.02, Price: 1100000, Amount: 22000,
+			CommissionAmount: 88, CommissionCurrency: "RUB"},
+	))
+
+	// duplicates are skipped
+	require.NoError(t, l.AddTrades(exmo.UserTrade{TradeId: 1, Date: day(3), Type: "buy", Pair: "BTC_RUB", Quantity: 0.1, Price: 1000000, Amount: 100000}))
+	require.Len(t, l.Entries(), 4)
+
+	expected := l.ExpectedBalances()
+	require.InDelta(t, 200000-100000+22000-88, expected["RUB"], 1e-6)
+	require.InDelta(t, 0.1-0.0004-0.02-0.05-0.0005, expected["BTC"], 1e-12)
+	require.InDelta(t, 88, l.Balance(AccountFees)["RUB"], 1e-9)
+	require.InDelta(t, 0.0009, l.Balance(AccountFees)["BTC"], 1e-12)
+
+	// every currency sums to zero over all accounts
+	total := map[string]float64{}
+	for _, e := range l.Entries() {
+		for _, p := range e.Postings {
+			total[p.Currency] += p.Amount
+		}
+	}
+	for currency, sum := range total {
+		require.InDelta(t, 0, sum, 1e-9, currency)
+	}
+
+	t.Run("Reconcile", func(t *testing.T) {
+		userInfo := exmo.ApiResponse{
+			"uid":         float64(1),
+			"server_date": float64(1570000000),
+			"balances":    map[string]interface{}{"RUB": "121912", "BTC": "0.0191", "USD": "0"},
+			"reserved":    map[string]interface{}{"RUB": "0", "BTC": "0.01", "USD": "5"},
+		}
+		discrepancies, err := l.Reconcile(userInfo, 1e-8)
+		require.NoError(t, err)
+		require.Len(t, discrepancies, 1)
+		require.Equal(t, "USD", discrepancies[0].Currency)
+		require.Equal(t, 5.0, discrepancies[0].Difference)
+	})
+
+	t.Run("Opening", func(t *testing.T) {
+		l := New()
+		require.NoError(t, l.AddOpening(day(1), map[string]float64{"BTC": 1}))
+		require.Equal(t, map[string]float64{"BTC": 1}, l.ExpectedBalances())
+		require.Equal(t, map[string]float64{"BTC": -1}, l.Balance(AccountOpening))
+	})
+
+	t.Run("Unbalanced", func(t *testing.T) {
+		require.Error(t, New().Post(Entry{Ref: "x", Postings: []Posting{{AccountAssets, "BTC", 1}}}))
+	})
+}
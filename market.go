@@ -0,0 +1,248 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarketData is the public part of the API used for pricing and simulation.
+// *Exmo satisfies it.
+type MarketData interface {
+	Ticker() (ApiResponse, error)
+	GetOrderBook(pair string, limit int) (ApiResponse, error)
+	GetPairSettings() (ApiResponse, error)
+}
+
+// PairSettings holds limits and commissions of a currency pair.
+type PairSettings struct {
+	MinQuantity            float64
+	MaxQuantity            float64
+	MinPrice               float64
+	MaxPrice               float64
+	MinAmount              float64
+	MaxAmount              float64
+	PricePrecision         int // number of decimal places allowed in price, -1 if unknown
+	CommissionTakerPercent float64
+	CommissionMakerPercent float64
+}
+
+// BookLevel is a single price level of the order book.
+type BookLevel struct {
+	Price    float64
+	Quantity float64
+	Amount   float64
+}
+
+// OrderBook is a snapshot of the book of current orders on the currency pair.
+type OrderBook struct {
+	Pair string
+	Ask  []BookLevel // sell orders, best (lowest) price first
+	Bid  []BookLevel // buy orders, best (highest) price first
+}
+
+// TickerItem holds statistics on prices and volume of trades by currency pair.
+type TickerItem struct {
+	BuyPrice  float64 // best bid
+	SellPrice float64 // best ask
+	LastTrade float64
+	High      float64
+	Low       float64
+	Avg       float64
+	Vol       float64
+	VolCurr   float64
+	Updated   time.Time
+}
+
+// ParsePairSettings converts GetPairSettings response to typed settings keyed by pair.
+func ParsePairSettings(resp ApiResponse) (map[string]PairSettings, error) {
+	settings := make(map[string]PairSettings, len(resp))
+	for pair, value := range resp {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("pair settings for %s: unexpected format", pair)
+		}
+
+		var s PairSettings
+		var err error
+		for key, dst := range map[string]*float64{
+			"min_quantity":             &s.MinQuantity,
+			"max_quantity":             &s.MaxQuantity,
+			"min_price":                &s.MinPrice,
+			"max_price":                &s.MaxPrice,
+			"min_amount":               &s.MinAmount,
+			"max_amount":               &s.MaxAmount,
+			"commission_taker_percent": &s.CommissionTakerPercent,
+			"commission_maker_percent": &s.CommissionMakerPercent,
+		} {
+			if v, ok := fields[key]; ok {
+				if *dst, err = toFloat(v); err != nil {
+					return nil, fmt.Errorf("pair settings for %s: %s: %s", pair, key, err)
+				}
+			}
+		}
+
+		s.PricePrecision = -1
+		if v, ok := fields["price_precision"]; ok {
+			precision, err := toFloat(v)
+			if err != nil {
+				return nil, fmt.Errorf("pair settings for %s: price_precision: %s", pair, err)
+			}
+			s.PricePrecision = int(precision)
+		}
+
+		settings[pair] = s
+	}
+
+	return settings, nil
+}
+
+// ParseOrderBook converts GetOrderBook response to typed book of the specified pair.
+func ParseOrderBook(resp ApiResponse, pair string) (OrderBook, error) {
+	book := OrderBook{Pair: pair}
+
+	value, ok := resp[pair]
+	if !ok {
+		return book, fmt.Errorf("order book for %s not found in response", pair)
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return book, fmt.Errorf("order book for %s: unexpected format", pair)
+	}
+
+	var err error
+	if book.Ask, err = parseBookSide(fields["ask"]); err != nil {
+		return book, fmt.Errorf("order book for %s: ask: %s", pair, err)
+	}
+	if book.Bid, err = parseBookSide(fields["bid"]); err != nil {
+		return book, fmt.Errorf("order book for %s: bid: %s", pair, err)
+	}
+
+	return book, nil
+}
+
+func parseBookSide(side interface{}) ([]BookLevel, error) {
+	if side == nil {
+		return nil, nil
+	}
+	rows, ok := side.([]interface{})
+	if !ok {
+		return nil, errors.New("unexpected format")
+	}
+
+	levels := make([]BookLevel, 0, len(rows))
+	for _, row := range rows {
+		cols, ok := row.([]interface{})
+		if !ok || len(cols) < 2 {
+			return nil, errors.New("unexpected level format")
+		}
+
+		var level BookLevel
+		var err error
+		if level.Price, err = toFloat(cols[0]); err != nil {
+			return nil, err
+		}
+		if level.Quantity, err = toFloat(cols[1]); err != nil {
+			return nil, err
+		}
+		if len(cols) > 2 {
+			if level.Amount, err = toFloat(cols[2]); err != nil {
+				return nil, err
+			}
+		} else {
+			level.Amount = level.Price * level.Quantity
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// ParseTicker converts Ticker response to typed statistics keyed by pair.
+func ParseTicker(resp ApiResponse) (map[string]TickerItem, error) {
+	ticker := make(map[string]TickerItem, len(resp))
+	for pair, value := range resp {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("ticker for %s: unexpected format", pair)
+		}
+
+		var item TickerItem
+		var err error
+		for key, dst := range map[string]*float64{
+			"buy_price":  &item.BuyPrice,
+			"sell_price": &item.SellPrice,
+			"last_trade": &item.LastTrade,
+			"high":       &item.High,
+			"low":        &item.Low,
+			"avg":        &item.Avg,
+			"vol":        &item.Vol,
+			"vol_curr":   &item.VolCurr,
+		} {
+			if v, ok := fields[key]; ok {
+				if *dst, err = toFloat(v); err != nil {
+					return nil, fmt.Errorf("ticker for %s: %s: %s", pair, key, err)
+				}
+			}
+		}
+		if v, ok := fields["updated"]; ok {
+			updated, err := toFloat(v)
+			if err != nil {
+				return nil, fmt.Errorf("ticker for %s: updated: %s", pair, err)
+			}
+			item.Updated = time.Unix(int64(updated), 0).UTC()
+		}
+
+		ticker[pair] = item
+	}
+
+	return ticker, nil
+}
+
+// SplitPair returns base and quote currencies of the pair, e.g. BTC and RUB for BTC_RUB.
+func SplitPair(pair string) (base string, quote string, err error) {
+	i := strings.Index(pair, "_")
+	if i <= 0 || i == len(pair)-1 {
+		return "", "", fmt.Errorf("invalid currency pair %q", pair)
+	}
+	return pair[:i], pair[i+1:], nil
+}
+
+// toFloat converts API numeric values, which come either as JSON numbers or as strings.
+func toFloat(v interface{}) (float64, error) {
+	switch val := v.(type) {
+	case float64:
+		return val, nil
+	case string:
+		return strconv.ParseFloat(val, 64)
+	case int:
+		return float64(val), nil
+	case int64:
+		return float64(val), nil
+	default:
+		return 0, fmt.Errorf("can't convert %#v to float64", v)
+	}
+}
+
+// formatFloat formats number the way the API expects it in request params.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,154 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// stubMarket serves fixed public API responses.
+type stubMarket struct {
+	ticker   string
+	books    map[string]string
+	settings string
+}
+
+func (m *stubMarket) Ticker() (ApiResponse, error) {
+	return decodeResponse(m.ticker), nil
+}
+
+// GetOrderBook serves books of one or several comma-separated pairs.
+func (m *stubMarket) GetOrderBook(pair string, limit int) (ApiResponse, error) {
+	var books []string
+	for _, p := range strings.Split(pair, ",") {
+		books = append(books, `"`+p+`":`+m.books[p])
+	}
+	return decodeResponse(`{` + strings.Join(books, ",") + `}`), nil
+}
+
+func (m *stubMarket) GetPairSettings() (ApiResponse, error) {
+	return decodeResponse(m.settings), nil
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// stubApi creates Exmo instance whose requests are served by handler (API method and params -> response body).
+func stubApi(handler func(method string, params url.Values) string, opts ...Option) Exmo {
+	// no rate limiting unless requested by the test
+	ex := Api("key", "secret", append([]Option{WithRateLimit(0)}, opts...)...)
+	ex.client = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(r.Body)
+		params, _ := url.ParseQuery(string(body))
+		method := strings.TrimPrefix(r.URL.Path, "/v1/")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Status:     "200 OK",
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(handler(method, params))),
+		}, nil
+	})}
+	return ex
+}
+
+func decodeResponse(body string) ApiResponse {
+	var resp ApiResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		panic(err)
+	}
+	return resp
+}
+
+const testPairSettings = `{
+	"BTC_RUB": {"min_quantity":"0.001","max_quantity":"100","min_price":"1","max_price":"10000000","min_amount":"10","max_amount":"50000000","price_precision":2,"commission_taker_percent":"0.4","commission_maker_percent":"0.2"},
+	"ETH_BTC": {"min_quantity":"0.01","max_quantity":"1000","min_price":"0.0001","max_price":"1","min_amount":"0.0001","max_amount":"100","price_precision":6,"commission_taker_percent":"0.4","commission_maker_percent":"0.2"},
+	"ETH_RUB": {"min_quantity":"0.01","max_quantity":"1000","min_price":"1","max_price":"1000000","min_amount":"10","max_amount":"50000000","price_precision":2,"commission_taker_percent":"0.4","commission_maker_percent":"0.2"}
+}`
+
+const testTicker = `{
+	"BTC_RUB": {"buy_price":"999000","sell_price":"1000000","last_trade":"999500","high":"1010000","low":"990000","avg":"1000000","vol":"10","vol_curr":"10000000","updated":1570000000},
+	"ETH_BTC": {"buy_price":"0.0199","sell_price":"0.02","last_trade":"0.02","high":"0.021","low":"0.019","avg":"0.02","vol":"100","vol_curr":"2","updated":1570000000},
+	"ETH_RUB": {"buy_price":"19900","sell_price":"20000","last_trade":"20000","high":"21000","low":"19000","avg":"20000","vol":"100","vol_curr":"2000000","updated":1570000000}
+}`
+
+func newStubMarket() *stubMarket {
+	return &stubMarket{
+		ticker:   testTicker,
+		settings: testPairSettings,
+		books: map[string]string{
+			"BTC_RUB": `{"ask_top":"1000000","bid_top":"999000",
+				"ask":[["1000000","0.5","500000"],["1001000","1","1001000"]],
+				"bid":[["999000","0.5","499500"],["998000","1","998000"]]}`,
+			"ETH_BTC": `{"ask":[["0.02","10","0.2"],["0.021","10","0.21"]],"bid":[["0.0199","10","0.199"],["0.0198","10","0.198"]]}`,
+			"ETH_RUB": `{"ask":[["20000","10","200000"],["20100","10","201000"]],"bid":[["19900","10","199000"],["19800","10","198000"]]}`,
+		},
+	}
+}
+
+func TestParsers(t *testing.T) {
+	market := newStubMarket()
+
+	t.Run("ParsePairSettings", func(t *testing.T) {
+		resp, _ := market.GetPairSettings()
+		settings, err := ParsePairSettings(resp)
+		require.NoError(t, err)
+		require.Equal(t, PairSettings{
+			MinQuantity: 0.001, MaxQuantity: 100, MinPrice: 1, MaxPrice: 10000000, MinAmount: 10, MaxAmount: 50000000,
+			PricePrecision: 2, CommissionTakerPercent: 0.4, CommissionMakerPercent: 0.2,
+		}, settings["BTC_RUB"])
+	})
+
+	t.Run("ParseOrderBook", func(t *testing.T) {
+		resp, _ := market.GetOrderBook("BTC_RUB", 100)
+		book, err := ParseOrderBook(resp, "BTC_RUB")
+		require.NoError(t, err)
+		require.Equal(t, []BookLevel{{1000000, 0.5, 500000}, {1001000, 1, 1001000}}, book.Ask)
+		require.Equal(t, 999000.0, book.Bid[0].Price)
+
+		_, err = ParseOrderBook(resp, "ETH_RUB")
+		require.Error(t, err)
+	})
+
+	t.Run("ParseTicker", func(t *testing.T) {
+		resp, _ := market.Ticker()
+		ticker, err := ParseTicker(resp)
+		require.NoError(t, err)
+		require.Equal(t, 999000.0, ticker["BTC_RUB"].BuyPrice)
+		require.Equal(t, 1000000.0, ticker["BTC_RUB"].SellPrice)
+		require.Equal(t, int64(1570000000), ticker["BTC_RUB"].Updated.Unix())
+	})
+
+	t.Run("SplitPair", func(t *testing.T) {
+		base, quote, err := SplitPair("BTC_RUB")
+		require.NoError(t, err)
+		require.Equal(t, "BTC", base)
+		require.Equal(t, "RUB", quote)
+
+		_, _, err = SplitPair("BTCRUB")
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,344 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ConversionLeg is a market order placed by ConversionExecutor.
+type ConversionLeg struct {
+	Pair      string
+	From      string
+	To        string
+	TypeOrder string // market_sell or market_buy_total
+	Quantity  string // quantity param sent to the exchange
+	ClientId  int64  // client order id the order is tagged with
+	OrderId   string
+	Trades    []UserTrade
+	Spent     float64 // From currency taken by the trades
+	Received  float64 // To currency received after commission
+	Err       error   // reason the leg failed, nil if it was filled
+	// Unconfirmed is set if the order may have been placed but its fills couldn't be read (the request creating
+	// it or reading its trades failed): the funds may have moved (partly or fully) to To currency, but the amount
+	// is unknown
+	Unconfirmed bool
+}
+
+// ConversionReport is the outcome of a multi-hop conversion.
+type ConversionReport struct {
+	From     string
+	To       string
+	AmountIn float64
+	Legs     []ConversionLeg // legs placed along the route, the last one failed if Complete is false
+	Complete bool
+
+	// Holding and HoldingAmount are the currency and its amount the conversion ended with:
+	// the target currency if complete, an intermediate one if it stopped half-way,
+	// or the source currency again after successful rollback. Both are empty if Pending is set.
+	Holding       string
+	HoldingAmount float64
+	// Pending is set if the conversion stopped at an unconfirmed leg, so where the funds are is unknown
+	// until fills of the leg's order are checked. Nothing is rolled back from such a leg.
+	Pending bool
+
+	Rollback   []ConversionLeg // orders converting the intermediate currency back
+	RolledBack bool
+}
+
+// ConversionExecutor executes conversion routes with market orders. Every leg is sized by the amount actually
+// received in the previous one, as reported by GetOrderTrades. Orders are tagged with client order ids: if
+// the request creating one fails, the order is looked up by the id when the trader supports it (as *Exmo
+// and *Paper do), otherwise the leg is left unconfirmed.
+type ConversionExecutor struct {
+	trader   Trader
+	market   MarketData
+	settings map[string]PairSettings
+
+	// Rollback converts the intermediate currency back to the source one when a leg fails.
+	Rollback bool
+	// FillAttempts is the number of GetOrderTrades (or FindOrderByClientId) requests made until trades
+	// of the order show up, 5 by default.
+	FillAttempts int
+	// FillInterval is the pause between the requests, 200ms by default.
+	FillInterval time.Duration
+}
+
+// NewConversionExecutor creates executor placing orders with the trader. Market data is used for pair settings.
+func NewConversionExecutor(trader Trader, market MarketData) *ConversionExecutor {
+	return &ConversionExecutor{trader: trader, market: market, FillAttempts: 5, FillInterval: 200 * time.Millisecond}
+}
+
+// ExecutePath executes path found by BestConversionPath. Amounts of legs after the first one
+// are taken from actual fills, not from the estimate.
+func (e *ConversionExecutor) ExecutePath(ctx context.Context, path ConversionPath) (ConversionReport, error) {
+	return e.Execute(ctx, path.From, path.AmountIn, path.Pairs())
+}
+
+// Execute converts the amount of from currency along the route (list of pairs). If a leg fails, the report
+// shows where the funds are and, with Rollback set, the orders converting them back. The error is returned
+// only if the conversion didn't complete.
+func (e *ConversionExecutor) Execute(ctx context.Context, from string, amount float64, route []string) (ConversionReport, error) {
+	report := ConversionReport{From: from, AmountIn: amount, Holding: from, HoldingAmount: amount}
+	if len(route) == 0 {
+		return report, fmt.Errorf("empty conversion route")
+	}
+	if err := e.loadSettings(); err != nil {
+		return report, err
+	}
+
+	// check the route before the first order is placed
+	currency := from
+	for _, pair := range route {
+		next, _, err := convertsTo(pair, currency)
+		if err != nil {
+			return report, err
+		}
+		currency = next
+	}
+	report.To = currency
+
+	for _, pair := range route {
+		leg := e.execute(ctx, pair, report.Holding, report.HoldingAmount)
+		report.Legs = append(report.Legs, leg)
+		if leg.Err != nil {
+			err := fmt.Errorf("leg %s %s: %s", leg.Pair, leg.TypeOrder, leg.Err)
+			if leg.Unconfirmed {
+				report.pending()
+				return report, err
+			}
+			if e.Rollback && len(report.Legs) > 1 {
+				e.rollback(ctx, &report)
+			}
+			return report, err
+		}
+		report.Holding, report.HoldingAmount = leg.To, leg.Received
+	}
+
+	report.Complete = true
+	return report, nil
+}
+
+// rollback converts the held currency back through the pairs of filled legs in reverse order.
+func (e *ConversionExecutor) rollback(ctx context.Context, report *ConversionReport) {
+	filled := report.Legs[:len(report.Legs)-1]
+	for i := len(filled) - 1; i >= 0; i-- {
+		leg := e.execute(ctx, filled[i].Pair, report.Holding, report.HoldingAmount)
+		report.Rollback = append(report.Rollback, leg)
+		if leg.Err != nil {
+			if leg.Unconfirmed {
+				report.pending()
+			}
+			return
+		}
+		report.Holding, report.HoldingAmount = leg.To, leg.Received
+	}
+	report.RolledBack = true
+}
+
+// pending marks the holding unknown after an unconfirmed leg.
+func (r *ConversionReport) pending() {
+	r.Holding, r.HoldingAmount, r.Pending = "", 0, true
+}
+
+// execute places a single market order converting the amount and reads its fills.
+func (e *ConversionExecutor) execute(ctx context.Context, pair, currency string, amount float64) ConversionLeg {
+	leg := ConversionLeg{Pair: pair, From: currency}
+	var err error
+	if leg.To, leg.TypeOrder, err = convertsTo(pair, currency); err != nil {
+		leg.Err = err
+		return leg
+	}
+	settings := e.settings[pair]
+
+	leg.Quantity = settings.RoundQuantity(amount, RoundDown)
+	if leg.Quantity, _, leg.Err = ValidateOrder(settings, pair, leg.Quantity, "0", leg.TypeOrder); leg.Err != nil {
+		return leg
+	}
+	if leg.Err = ctx.Err(); leg.Err != nil {
+		return leg
+	}
+
+	leg.ClientId = NewClientId()
+	resp, err := e.trader.OrderCreateWithClientId(pair, leg.Quantity, "0", leg.TypeOrder, leg.ClientId)
+	if err == nil {
+		leg.OrderId, err = orderIdOf(resp)
+	}
+	if err != nil {
+		// the order may have been placed anyway, e.g. if the response was lost
+		var known bool
+		if leg.OrderId, known = e.lookup(ctx, pair, leg.ClientId, err); leg.OrderId == "" {
+			leg.Err, leg.Unconfirmed = err, !known
+			return leg
+		}
+	}
+
+	if leg.Trades, leg.Err = e.orderTrades(ctx, leg.OrderId); leg.Err != nil {
+		leg.Unconfirmed = true
+		return leg
+	}
+	leg.Spent, leg.Received = settlement(leg.Trades, leg.To, leg.TypeOrder == "market_buy_total", settings.CommissionTakerPercent)
+	return leg
+}
+
+// clientOrderFinder is implemented by traders able to find orders by client order id.
+type clientOrderFinder interface {
+	FindOrderByClientId(pair string, clientId int64) (ClientOrder, bool, error)
+}
+
+// lookup looks for the order tagged with the client id after the request creating it failed with the error.
+// It returns id of the order if it was placed, and whether that is known: orders rejected by risk limits
+// are never sent, others are looked up until their trades show up.
+func (e *ConversionExecutor) lookup(ctx context.Context, pair string, clientId int64, err error) (string, bool) {
+	if _, ok := err.(*RiskLimitError); ok || err == ErrKillSwitch {
+		return "", true
+	}
+	finder, ok := e.trader.(clientOrderFinder)
+	if !ok {
+		return "", false
+	}
+	attempts := e.FillAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	known := false
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(e.FillInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return "", false
+			case <-timer.C:
+			}
+		}
+		order, found, findErr := finder.FindOrderByClientId(pair, clientId)
+		if found {
+			return order.OrderId, true
+		}
+		known = findErr == nil
+	}
+	return "", known
+}
+
+// orderTrades requests trades of the order until they show up.
+func (e *ConversionExecutor) orderTrades(ctx context.Context, orderId string) ([]UserTrade, error) {
+	attempts := e.FillAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(e.FillInterval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		resp, err := e.trader.GetOrderTrades(orderId)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		list, _ := resp["trades"].([]interface{})
+		trades, err := parseTradeList(list)
+		if err != nil {
+			return nil, fmt.Errorf("order trades: %s", err)
+		}
+		if len(trades) > 0 {
+			return trades, nil
+		}
+		lastErr = fmt.Errorf("no trades of order %s", orderId)
+	}
+	return nil, lastErr
+}
+
+func (e *ConversionExecutor) loadSettings() error {
+	if e.settings != nil {
+		return nil
+	}
+	resp, err := e.market.GetPairSettings()
+	if err != nil {
+		return err
+	}
+	e.settings, err = ParsePairSettings(resp)
+	return err
+}
+
+// convertsTo returns currency the pair converts the currency to and the market order type doing it.
+func convertsTo(pair, currency string) (string, string, error) {
+	base, quote, err := SplitPair(pair)
+	if err != nil {
+		return "", "", err
+	}
+	switch currency {
+	case base:
+		return quote, "market_sell", nil
+	case quote:
+		return base, "market_buy_total", nil
+	default:
+		return "", "", fmt.Errorf("pair %s doesn't convert %s", pair, currency)
+	}
+}
+
+// settlement sums amounts spent and received (after commission) by the trades of an order. Commission is taken
+// from the trades if reported, otherwise the commission percent is applied.
+func settlement(trades []UserTrade, received string, buy bool, commissionPercent float64) (float64, float64) {
+	var spent, gross, commission float64
+	reported := false
+	for _, t := range trades {
+		if buy {
+			spent += t.Amount
+			gross += t.Quantity
+		} else {
+			spent += t.Quantity
+			gross += t.Amount
+		}
+		if t.CommissionCurrency != "" {
+			reported = true
+			if t.CommissionCurrency == received {
+				commission += t.CommissionAmount
+			}
+		}
+	}
+	if !reported {
+		commission = gross * commissionPercent / 100
+	}
+	return spent, gross - commission
+}
+
+// orderIdOf extracts order id from OrderCreate response.
+func orderIdOf(resp ApiResponse) (string, error) {
+	switch id := resp["order_id"].(type) {
+	case float64:
+		return strconv.FormatInt(int64(id), 10), nil
+	case string:
+		if id != "" {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no order_id in response")
+}
@@ -0,0 +1,196 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blindPaper fails GetOrderTrades of orders after the first one.
+type blindPaper struct {
+	*Paper
+}
+
+func (p *blindPaper) GetOrderTrades(orderId string) (ApiResponse, error) {
+	if orderId != "1" {
+		return nil, errors.New("connection lost")
+	}
+	return p.Paper.GetOrderTrades(orderId)
+}
+
+// lostPaper places orders after the first one but fails the request as if the response was lost.
+type lostPaper struct {
+	*Paper
+	noOrderId bool // return response without order_id instead of the error
+}
+
+func (p *lostPaper) OrderCreateWithClientId(pair string, quantity string, price string, typeOrder string, clientId int64) (ApiResponse, error) {
+	resp, err := p.Paper.OrderCreateWithClientId(pair, quantity, price, typeOrder, clientId)
+	if err != nil || resp["order_id"] == float64(1) {
+		return resp, err
+	}
+	if p.noOrderId {
+		return ApiResponse{"result": true, "error": ""}, nil
+	}
+	return nil, &ClientOrderError{ClientId: clientId, Err: errors.New("timeout")}
+}
+
+// opaqueTrader hides FindOrderByClientId of the wrapped trader.
+type opaqueTrader struct {
+	Trader
+}
+
+func TestConversionExecutor(t *testing.T) {
+	t.Run("Complete", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 100000})
+		e := NewConversionExecutor(p, market)
+
+		report, err := e.Execute(context.Background(), "RUB", 100000, []string{"BTC_RUB", "ETH_BTC"})
+		require.NoError(t, err)
+		require.True(t, report.Complete)
+		require.Len(t, report.Legs, 2)
+
+		// the second leg spends exactly what the first one received
+		require.Equal(t, "market_buy_total", report.Legs[0].TypeOrder)
+		require.InDelta(t, 0.0996, report.Legs[0].Received, 1e-12)
+		require.Equal(t, "0.0996", report.Legs[1].Quantity)
+		require.Equal(t, "ETH", report.Holding)
+		require.InDelta(t, 0.0996/0.02*0.996, report.HoldingAmount, 1e-9)
+
+		require.InDelta(t, 0, paperBalance(t, p, "balances", "BTC"), 1e-12)
+		require.InDelta(t, report.HoldingAmount, paperBalance(t, p, "balances", "ETH"), 1e-12)
+	})
+
+	t.Run("ExecutePath", func(t *testing.T) {
+		market := newStubMarket()
+		path, err := BestConversionPath(market, "ETH", "RUB", 2, 0)
+		require.NoError(t, err)
+
+		p := NewPaper(market, map[string]float64{"ETH": 2})
+		report, err := NewConversionExecutor(p, market).ExecutePath(context.Background(), path)
+		require.NoError(t, err)
+		require.Equal(t, "RUB", report.To)
+		require.InDelta(t, path.AmountOut, report.HoldingAmount, 1e-9)
+	})
+
+	t.Run("PartialWithRollback", func(t *testing.T) {
+		market := newStubMarket()
+		market.books["ETH_BTC"] = `{"ask":[["0.02","1","0.02"]],"bid":[["0.0199","1","0.0199"]]}`
+		p := NewPaper(market, map[string]float64{"RUB": 100000})
+		e := NewConversionExecutor(p, market)
+		e.FillInterval = 0
+
+		report, err := e.Execute(context.Background(), "RUB", 100000, []string{"BTC_RUB", "ETH_BTC"})
+		require.Error(t, err)
+		require.False(t, report.Complete)
+		require.Len(t, report.Legs, 2)
+		require.Equal(t, ErrInsufficientLiquidity, report.Legs[1].Err)
+		require.Equal(t, "BTC", report.Holding)
+		require.False(t, report.RolledBack)
+
+		e.Rollback = true
+		p = NewPaper(market, map[string]float64{"RUB": 100000})
+		e.trader = p
+		report, err = e.Execute(context.Background(), "RUB", 100000, []string{"BTC_RUB", "ETH_BTC"})
+		require.Error(t, err)
+		require.True(t, report.RolledBack)
+		require.Len(t, report.Rollback, 1)
+		require.Equal(t, "market_sell", report.Rollback[0].TypeOrder)
+		require.Equal(t, "RUB", report.Holding)
+		require.InDelta(t, 0.0996*999000*0.996, report.HoldingAmount, 1e-6)
+		require.InDelta(t, report.HoldingAmount, paperBalance(t, p, "balances", "RUB"), 1e-6)
+	})
+
+	t.Run("Unconfirmed", func(t *testing.T) {
+		market := newStubMarket()
+		p := &blindPaper{NewPaper(market, map[string]float64{"ETH": 1, "BTC": 5})}
+		e := NewConversionExecutor(p, market)
+		e.Rollback = true
+		e.FillAttempts = 2
+		e.FillInterval = 0
+
+		report, err := e.Execute(context.Background(), "ETH", 1, []string{"ETH_BTC", "BTC_RUB"})
+		require.Error(t, err)
+		require.Len(t, report.Legs, 2)
+		require.Equal(t, "2", report.Legs[1].OrderId)
+		require.True(t, report.Legs[1].Unconfirmed)
+		require.False(t, report.Legs[0].Unconfirmed)
+		require.True(t, report.Pending)
+		require.Empty(t, report.Holding)
+		require.Zero(t, report.HoldingAmount)
+
+		// the BTC was sold, nothing is rolled back and the unrelated BTC balance is untouched
+		require.Empty(t, report.Rollback)
+		require.False(t, report.RolledBack)
+		require.InDelta(t, 5, paperBalance(t, p.Paper, "balances", "BTC"), 1e-12)
+		require.InDelta(t, 0, paperBalance(t, p.Paper, "balances", "ETH"), 1e-12)
+	})
+
+	t.Run("LostResponse", func(t *testing.T) {
+		// the order placed without response is found by client id and the conversion goes on
+		market := newStubMarket()
+		p := &lostPaper{Paper: NewPaper(market, map[string]float64{"ETH": 1})}
+		e := NewConversionExecutor(p, market)
+		e.FillInterval = 0
+
+		report, err := e.Execute(context.Background(), "ETH", 1, []string{"ETH_BTC", "BTC_RUB"})
+		require.NoError(t, err)
+		require.True(t, report.Complete)
+		require.Equal(t, "2", report.Legs[1].OrderId)
+		require.NotZero(t, report.Legs[1].ClientId)
+		require.InDelta(t, paperBalance(t, p.Paper, "balances", "RUB"), report.HoldingAmount, 1e-6)
+
+		p = &lostPaper{Paper: NewPaper(market, map[string]float64{"ETH": 1}), noOrderId: true}
+		e.trader = p
+		report, err = e.Execute(context.Background(), "ETH", 1, []string{"ETH_BTC", "BTC_RUB"})
+		require.NoError(t, err)
+		require.True(t, report.Complete)
+		require.Equal(t, "2", report.Legs[1].OrderId)
+	})
+
+	t.Run("LostResponseUnconfirmed", func(t *testing.T) {
+		// without FindOrderByClientId the order may have been placed, so nothing is rolled back
+		market := newStubMarket()
+		for _, noOrderId := range []bool{false, true} {
+			p := &lostPaper{Paper: NewPaper(market, map[string]float64{"ETH": 1}), noOrderId: noOrderId}
+			e := NewConversionExecutor(opaqueTrader{p}, market)
+			e.Rollback = true
+
+			report, err := e.Execute(context.Background(), "ETH", 1, []string{"ETH_BTC", "BTC_RUB"})
+			require.Error(t, err)
+			require.Len(t, report.Legs, 2)
+			require.True(t, report.Legs[1].Unconfirmed)
+			require.Empty(t, report.Legs[1].OrderId)
+			require.True(t, report.Pending)
+			require.Empty(t, report.Rollback)
+			require.InDelta(t, 0, paperBalance(t, p.Paper, "balances", "BTC"), 1e-12)
+		}
+	})
+
+	t.Run("InvalidRoute", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 100000})
+		_, err := NewConversionExecutor(p, market).Execute(context.Background(), "RUB", 100000, []string{"ETH_BTC"})
+		require.Error(t, err)
+		require.Empty(t, p.trades)
+	})
+}
@@ -0,0 +1,586 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Trader is the set of trading methods implemented both by live client (*Exmo) and paper client (*Paper).
+type Trader interface {
+	OrderCreate(pair string, quantity string, price string, typeOrder string) (ApiResponse, error)
+	OrderCreateWithClientId(pair string, quantity string, price string, typeOrder string, clientId int64) (ApiResponse, error)
+	Buy(pair string, quantity string, price string) (ApiResponse, error)
+	Sell(pair string, quantity string, price string) (ApiResponse, error)
+	MarketBuy(pair string, quantity string) (ApiResponse, error)
+	MarketBuyTotal(pair string, quantity string) (ApiResponse, error)
+	MarketSell(pair string, quantity string) (ApiResponse, error)
+	MarketSellTotal(pair string, quantity string) (ApiResponse, error)
+	OrderCancel(orderId string) (ApiResponse, error)
+	GetUserOpenOrders() (ApiResponse, error)
+	GetUserInfo() (ApiResponse, error)
+	GetOrderTrades(orderId string) (ApiResponse, error)
+}
+
+var (
+	// ErrInsufficientFunds is returned by paper client when virtual balance can't cover the order.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrInsufficientLiquidity is returned by paper client when the book is too thin to fill market order.
+	ErrInsufficientLiquidity = errors.New("insufficient liquidity in the order book")
+	// ErrOrderNotFound is returned by paper client when there is no open order with the specified id.
+	ErrOrderNotFound = errors.New("order not found")
+)
+
+// paperBookDepth is the number of book levels requested for fill simulation.
+const paperBookDepth = 1000
+
+// epsilon is the quantity below which order remainder is considered filled.
+const epsilon = 1e-12
+
+// Paper is a paper-trading client. It takes prices from live market data
+// but keeps orders and balances locally, so nothing is ever sent to the exchange.
+type Paper struct {
+	mu          sync.Mutex
+	market      MarketData
+	settings    map[string]PairSettings
+	balances    map[string]float64
+	reserved    map[string]float64
+	orders      map[int64]*paperOrder
+	trades      map[int64][]paperTrade
+	lastOrderId int64
+	lastTradeId int64
+	now         func() time.Time
+}
+
+type paperOrder struct {
+	id       int64
+	clientId int64
+	pair     string
+	typ      string
+	price    float64
+	quantity float64 // remaining quantity
+	created  time.Time
+}
+
+type paperTrade struct {
+	id                 int64
+	date               time.Time
+	typ                string
+	execType           string
+	pair               string
+	orderId            int64
+	clientId           int64
+	quantity           float64
+	price              float64
+	amount             float64
+	commissionAmount   float64
+	commissionCurrency string
+	commissionPercent  float64
+}
+
+// NewPaper creates paper-trading client with the initial virtual balances (currency -> amount).
+// Market data (usually live *Exmo instance) is used for prices, order book and commissions.
+func NewPaper(market MarketData, balances map[string]float64) *Paper {
+	p := &Paper{
+		market:   market,
+		balances: make(map[string]float64),
+		reserved: make(map[string]float64),
+		orders:   make(map[int64]*paperOrder),
+		trades:   make(map[int64][]paperTrade),
+		now:      time.Now,
+	}
+	for currency, amount := range balances {
+		p.balances[currency] = amount
+	}
+	return p
+}
+
+// OrderCreate creates virtual order and fills it against the live order book.
+// The part of limit order that can't be filled immediately rests until Sync fills or OrderCancel cancels it.
+func (p *Paper) OrderCreate(pair string, quantity string, price string, typeOrder string) (ApiResponse, error) {
+	return p.OrderCreateWithClientId(pair, quantity, price, typeOrder, 0)
+}
+
+// OrderCreateWithClientId creates virtual order tagged with client order id (0 means no id). The id is
+// returned in "client_id" field and listed in open orders and trades of the order.
+func (p *Paper) OrderCreateWithClientId(pair string, quantity string, price string, typeOrder string, clientId int64) (ApiResponse, error) {
+	base, quote, err := SplitPair(pair)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	settings, err := p.pairSettings(pair)
+	if err != nil {
+		return nil, err
+	}
+	// the exchange would reject the same orders
+	quantity, price, err = ValidateOrder(settings, pair, quantity, price, typeOrder)
+	if err != nil {
+		return nil, err
+	}
+	q, _ := strconv.ParseFloat(quantity, 64)
+	pr, _ := strconv.ParseFloat(price, 64)
+
+	book, err := p.orderBook(pair)
+	if err != nil {
+		return nil, err
+	}
+	taker := settings.CommissionTakerPercent
+
+	var fills []BookLevel
+	switch typeOrder {
+	case "buy", "sell":
+		if typeOrder == "buy" {
+			if p.balances[quote] < q*pr-epsilon {
+				return nil, ErrInsufficientFunds
+			}
+			fills = takeLiquidity(book.Ask, q, false, func(level float64) bool { return level <= pr })
+		} else {
+			if p.balances[base] < q-epsilon {
+				return nil, ErrInsufficientFunds
+			}
+			fills = takeLiquidity(book.Bid, q, false, func(level float64) bool { return level >= pr })
+		}
+	case "market_buy", "market_buy_total":
+		fills = takeLiquidity(book.Ask, q, typeOrder == "market_buy_total", nil)
+		if filledQuantity(fills, typeOrder == "market_buy_total") < q-epsilon {
+			return nil, ErrInsufficientLiquidity
+		}
+		if p.balances[quote] < filledAmount(fills)-epsilon {
+			return nil, ErrInsufficientFunds
+		}
+	case "market_sell", "market_sell_total":
+		fills = takeLiquidity(book.Bid, q, typeOrder == "market_sell_total", nil)
+		if filledQuantity(fills, typeOrder == "market_sell_total") < q-epsilon {
+			return nil, ErrInsufficientLiquidity
+		}
+		if p.balances[base] < filledQuantity(fills, false)-epsilon {
+			return nil, ErrInsufficientFunds
+		}
+	}
+
+	p.lastOrderId++
+	order := &paperOrder{id: p.lastOrderId, clientId: clientId, pair: pair, typ: typeOrder, price: pr, quantity: q, created: p.now()}
+
+	buy := typeOrder == "buy" || typeOrder == "market_buy" || typeOrder == "market_buy_total"
+	for _, fill := range fills {
+		p.execute(order, buy, fill.Price, fill.Quantity, "taker", taker)
+		order.quantity -= fill.Quantity
+	}
+
+	if (typeOrder == "buy" || typeOrder == "sell") && order.quantity > epsilon {
+		if buy {
+			p.balances[quote] -= order.quantity * order.price
+			p.reserved[quote] += order.quantity * order.price
+		} else {
+			p.balances[base] -= order.quantity
+			p.reserved[base] += order.quantity
+		}
+		p.orders[order.id] = order
+	}
+
+	resp := ApiResponse{"result": true, "error": "", "order_id": float64(order.id)}
+	if clientId != 0 {
+		resp["client_id"] = float64(clientId)
+	}
+	return resp, nil
+}
+
+// Buy creates virtual buy order
+func (p *Paper) Buy(pair string, quantity string, price string) (ApiResponse, error) {
+	return p.OrderCreate(pair, quantity, price, "buy")
+}
+
+// Sell creates virtual sell order
+func (p *Paper) Sell(pair string, quantity string, price string) (ApiResponse, error) {
+	return p.OrderCreate(pair, quantity, price, "sell")
+}
+
+// MarketBuy creates virtual market buy-order
+func (p *Paper) MarketBuy(pair string, quantity string) (ApiResponse, error) {
+	return p.OrderCreate(pair, quantity, "0", "market_buy")
+}
+
+// MarketBuyTotal creates virtual market buy-order for a certain amount (quantity parameter)
+func (p *Paper) MarketBuyTotal(pair string, quantity string) (ApiResponse, error) {
+	return p.OrderCreate(pair, quantity, "0", "market_buy_total")
+}
+
+// MarketSell creates virtual market sell-order
+func (p *Paper) MarketSell(pair string, quantity string) (ApiResponse, error) {
+	return p.OrderCreate(pair, quantity, "0", "market_sell")
+}
+
+// MarketSellTotal creates virtual market sell-order for a certain amount (quantity parameter)
+func (p *Paper) MarketSellTotal(pair string, quantity string) (ApiResponse, error) {
+	return p.OrderCreate(pair, quantity, "0", "market_sell_total")
+}
+
+// OrderCancel cancels virtual order and releases reserved funds
+func (p *Paper) OrderCancel(orderId string) (ApiResponse, error) {
+	id, err := strconv.ParseInt(orderId, 10, 64)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	order, ok := p.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	base, quote, _ := SplitPair(order.pair)
+	if order.typ == "buy" {
+		p.reserved[quote] -= order.quantity * order.price
+		p.balances[quote] += order.quantity * order.price
+	} else {
+		p.reserved[base] -= order.quantity
+		p.balances[base] += order.quantity
+	}
+	delete(p.orders, id)
+
+	return ApiResponse{"result": true, "error": ""}, nil
+}
+
+// GetUserOpenOrders returns virtual orders resting in the book, in the format of the live API
+func (p *Paper) GetUserOpenOrders() (ApiResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	resp := ApiResponse{}
+	for _, order := range p.sortedOrders() {
+		fields := map[string]interface{}{
+			"order_id": strconv.FormatInt(order.id, 10),
+			"created":  strconv.FormatInt(order.created.Unix(), 10),
+			"type":     order.typ,
+			"pair":     order.pair,
+			"price":    formatFloat(order.price),
+			"quantity": formatFloat(order.quantity),
+			"amount":   formatFloat(order.quantity * order.price),
+		}
+		if order.clientId != 0 {
+			fields["client_id"] = strconv.FormatInt(order.clientId, 10)
+		}
+		list, _ := resp[order.pair].([]interface{})
+		resp[order.pair] = append(list, fields)
+	}
+
+	return resp, nil
+}
+
+// GetUserInfo returns virtual balances, in the format of the live API
+func (p *Paper) GetUserInfo() (ApiResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	balances := map[string]interface{}{}
+	reserved := map[string]interface{}{}
+	for currency := range p.balances {
+		balances[currency] = formatFloat(p.balances[currency])
+		reserved[currency] = formatFloat(p.reserved[currency])
+	}
+	for currency := range p.reserved {
+		balances[currency] = formatFloat(p.balances[currency])
+		reserved[currency] = formatFloat(p.reserved[currency])
+	}
+
+	return ApiResponse{
+		"uid":         float64(0),
+		"server_date": float64(p.now().Unix()),
+		"balances":    balances,
+		"reserved":    reserved,
+	}, nil
+}
+
+// GetOrderTrades returns virtual trades of the order, in the format of the live API
+func (p *Paper) GetOrderTrades(orderId string) (ApiResponse, error) {
+	id, err := strconv.ParseInt(orderId, 10, 64)
+	if err != nil {
+		return nil, ErrOrderNotFound
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	trades, ok := p.trades[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	base, quote, _ := SplitPair(trades[0].pair)
+
+	var baseAmount, quoteAmount float64
+	list := make([]interface{}, 0, len(trades))
+	for _, t := range trades {
+		baseAmount += t.quantity
+		quoteAmount += t.amount
+		list = append(list, map[string]interface{}{
+			"trade_id":            float64(t.id),
+			"date":                float64(t.date.Unix()),
+			"type":                t.typ,
+			"pair":                t.pair,
+			"order_id":            float64(t.orderId),
+			"client_id":           float64(t.clientId),
+			"quantity":            formatFloat(t.quantity),
+			"price":               formatFloat(t.price),
+			"amount":              formatFloat(t.amount),
+			"exec_type":           t.execType,
+			"commission_amount":   formatFloat(t.commissionAmount),
+			"commission_currency": t.commissionCurrency,
+			"commission_percent":  formatFloat(t.commissionPercent),
+		})
+	}
+
+	resp := ApiResponse{"type": trades[0].typ, "trades": list}
+	if trades[0].typ == "buy" {
+		resp["in_currency"], resp["in_amount"] = base, formatFloat(baseAmount)
+		resp["out_currency"], resp["out_amount"] = quote, formatFloat(quoteAmount)
+	} else {
+		resp["in_currency"], resp["in_amount"] = quote, formatFloat(quoteAmount)
+		resp["out_currency"], resp["out_amount"] = base, formatFloat(baseAmount)
+	}
+
+	return resp, nil
+}
+
+// FindOrderByClientId looks for the virtual order with the client order id among open orders and trades,
+// as Exmo.FindOrderByClientId does.
+func (p *Paper) FindOrderByClientId(pair string, clientId int64) (ClientOrder, bool, error) {
+	found := ClientOrder{ClientId: clientId, Pair: pair}
+	if clientId == 0 {
+		return found, false, nil
+	}
+
+	p.mu.Lock()
+	var orderId int64
+	for _, order := range p.orders {
+		if order.clientId == clientId && order.pair == pair {
+			orderId = order.id
+			found.Open = true
+			found.Order = OpenOrder{OrderId: strconv.FormatInt(order.id, 10), ClientId: clientId, Created: order.created,
+				Type: order.typ, Pair: pair, Price: order.price, Quantity: order.quantity, Amount: order.quantity * order.price}
+		}
+	}
+	for id, trades := range p.trades {
+		if orderId == 0 && trades[0].clientId == clientId && trades[0].pair == pair {
+			orderId = id
+		}
+	}
+	p.mu.Unlock()
+	if orderId == 0 {
+		return found, false, nil
+	}
+	found.OrderId = strconv.FormatInt(orderId, 10)
+
+	resp, err := p.GetOrderTrades(found.OrderId)
+	if isOrderNotFound(err) {
+		return found, true, nil
+	}
+	if err != nil {
+		return found, false, err
+	}
+	list, _ := resp["trades"].([]interface{})
+	if found.Trades, err = parseTradeList(list); err != nil {
+		return found, false, err
+	}
+	return found, true, nil
+}
+
+// Sync matches resting virtual orders against the current order book and fills them with maker commission.
+// Call it periodically (e.g. every time the strategy wakes up) to let limit orders execute.
+func (p *Paper) Sync() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	books := map[string]*OrderBook{}
+	for _, order := range p.sortedOrders() {
+		book, ok := books[order.pair]
+		if !ok {
+			fetched, err := p.orderBook(order.pair)
+			if err != nil {
+				return err
+			}
+			book = &fetched
+			books[order.pair] = book
+		}
+		settings, err := p.pairSettings(order.pair)
+		if err != nil {
+			return err
+		}
+
+		var fills []BookLevel
+		if order.typ == "buy" {
+			fills = takeLiquidity(book.Ask, order.quantity, false, func(level float64) bool { return level <= order.price })
+		} else {
+			fills = takeLiquidity(book.Bid, order.quantity, false, func(level float64) bool { return level >= order.price })
+		}
+
+		base, quote, _ := SplitPair(order.pair)
+		for _, fill := range fills {
+			// resting order executes at its own price, funds come from the reserve
+			if order.typ == "buy" {
+				p.reserved[quote] -= fill.Quantity * order.price
+				p.balances[quote] += fill.Quantity * order.price
+			} else {
+				p.reserved[base] -= fill.Quantity
+				p.balances[base] += fill.Quantity
+			}
+			p.execute(order, order.typ == "buy", order.price, fill.Quantity, "maker", settings.CommissionMakerPercent)
+			order.quantity -= fill.Quantity
+		}
+		if order.quantity <= epsilon {
+			delete(p.orders, order.id)
+		}
+	}
+
+	return nil
+}
+
+// execute moves funds for a single fill and records the trade. Caller must hold the lock.
+func (p *Paper) execute(order *paperOrder, buy bool, price, quantity float64, execType string, commissionPercent float64) {
+	base, quote, _ := SplitPair(order.pair)
+	amount := price * quantity
+
+	t := paperTrade{
+		date:              p.now(),
+		execType:          execType,
+		pair:              order.pair,
+		orderId:           order.id,
+		clientId:          order.clientId,
+		quantity:          quantity,
+		price:             price,
+		amount:            amount,
+		commissionPercent: commissionPercent,
+	}
+	// commission is charged in the currency being received
+	if buy {
+		t.typ = "buy"
+		t.commissionAmount = quantity * commissionPercent / 100
+		t.commissionCurrency = base
+		p.balances[quote] -= amount
+		p.balances[base] += quantity - t.commissionAmount
+	} else {
+		t.typ = "sell"
+		t.commissionAmount = amount * commissionPercent / 100
+		t.commissionCurrency = quote
+		p.balances[base] -= quantity
+		p.balances[quote] += amount - t.commissionAmount
+	}
+
+	p.lastTradeId++
+	t.id = p.lastTradeId
+	p.trades[order.id] = append(p.trades[order.id], t)
+}
+
+// pairSettings returns cached settings of the pair. Caller must hold the lock.
+func (p *Paper) pairSettings(pair string) (PairSettings, error) {
+	if p.settings == nil {
+		resp, err := p.market.GetPairSettings()
+		if err != nil {
+			return PairSettings{}, err
+		}
+		if p.settings, err = ParsePairSettings(resp); err != nil {
+			return PairSettings{}, err
+		}
+	}
+	settings, ok := p.settings[pair]
+	if !ok {
+		return PairSettings{}, fmt.Errorf("unknown currency pair %s", pair)
+	}
+	return settings, nil
+}
+
+func (p *Paper) orderBook(pair string) (OrderBook, error) {
+	resp, err := p.market.GetOrderBook(pair, paperBookDepth)
+	if err != nil {
+		return OrderBook{}, err
+	}
+	return ParseOrderBook(resp, pair)
+}
+
+func (p *Paper) sortedOrders() []*paperOrder {
+	orders := make([]*paperOrder, 0, len(p.orders))
+	for _, order := range p.orders {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].id < orders[j].id })
+	return orders
+}
+
+// takeLiquidity consumes book levels accepted by the price filter (nil accepts any)
+// until the limit is reached and returns the fills. Limit is quantity of base currency
+// or, if byAmount is set, amount of quote currency. Consumed volume is subtracted from levels.
+func takeLiquidity(levels []BookLevel, limit float64, byAmount bool, accept func(price float64) bool) []BookLevel {
+	var fills []BookLevel
+	for i := range levels {
+		if limit <= epsilon {
+			break
+		}
+		level := &levels[i]
+		if level.Quantity <= epsilon {
+			continue
+		}
+		if accept != nil && !accept(level.Price) {
+			break
+		}
+
+		quantity := level.Quantity
+		if byAmount {
+			if quantity*level.Price > limit {
+				quantity = limit / level.Price
+			}
+			limit -= quantity * level.Price
+		} else {
+			if quantity > limit {
+				quantity = limit
+			}
+			limit -= quantity
+		}
+		level.Quantity -= quantity
+		level.Amount = level.Quantity * level.Price
+		fills = append(fills, BookLevel{Price: level.Price, Quantity: quantity, Amount: quantity * level.Price})
+	}
+	return fills
+}
+
+// filledQuantity sums fills in base currency or, if byAmount is set, in quote currency.
+func filledQuantity(fills []BookLevel, byAmount bool) float64 {
+	if byAmount {
+		return filledAmount(fills)
+	}
+	var sum float64
+	for _, fill := range fills {
+		sum += fill.Quantity
+	}
+	return sum
+}
+
+func filledAmount(fills []BookLevel) float64 {
+	var sum float64
+	for _, fill := range fills {
+		sum += fill.Amount
+	}
+	return sum
+}
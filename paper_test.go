@@ -0,0 +1,126 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ Trader = &Exmo{}
+var _ Trader = &Paper{}
+
+func paperBalance(t *testing.T, p *Paper, kind, currency string) float64 {
+	info, err := p.GetUserInfo()
+	require.NoError(t, err)
+	v, err := toFloat(info[kind].(map[string]interface{})[currency])
+	require.NoError(t, err)
+	return v
+}
+
+func TestPaper(t *testing.T) {
+	t.Run("MarketBuy", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 2000000})
+
+		order, err := p.MarketBuy("BTC_RUB", "1")
+		require.NoError(t, err)
+
+		// 0.5 @ 1000000 + 0.5 @ 1001000, 0.4% taker commission in BTC
+		require.InDelta(t, 2000000-1000500, paperBalance(t, p, "balances", "RUB"), 1e-6)
+		require.InDelta(t, 0.996, paperBalance(t, p, "balances", "BTC"), 1e-9)
+
+		trades, err := p.GetOrderTrades(strconv.Itoa(int(order["order_id"].(float64))))
+		require.NoError(t, err)
+		require.Len(t, trades["trades"], 2)
+		require.Equal(t, "BTC", trades["in_currency"])
+		require.Equal(t, "1000500", trades["out_amount"])
+	})
+
+	t.Run("MarketSellTotal", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"BTC": 1})
+
+		_, err := p.MarketSellTotal("BTC_RUB", "499500")
+		require.NoError(t, err)
+		require.InDelta(t, 0.5, paperBalance(t, p, "balances", "BTC"), 1e-9)
+		require.InDelta(t, 499500*0.996, paperBalance(t, p, "balances", "RUB"), 1e-6)
+	})
+
+	t.Run("InsufficientFunds", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 1000})
+
+		_, err := p.MarketBuy("BTC_RUB", "1")
+		require.Equal(t, ErrInsufficientFunds, err)
+		_, err = p.Buy("BTC_RUB", "1", "900000")
+		require.Equal(t, ErrInsufficientFunds, err)
+	})
+
+	t.Run("InsufficientLiquidity", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 100000000})
+
+		_, err := p.MarketBuy("BTC_RUB", "10")
+		require.Equal(t, ErrInsufficientLiquidity, err)
+	})
+
+	t.Run("LimitOrderRestsAndCancels", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 1000000})
+
+		order, err := p.Buy("BTC_RUB", "1", "900000")
+		require.NoError(t, err)
+		require.InDelta(t, 100000, paperBalance(t, p, "balances", "RUB"), 1e-6)
+		require.InDelta(t, 900000, paperBalance(t, p, "reserved", "RUB"), 1e-6)
+
+		open, err := p.GetUserOpenOrders()
+		require.NoError(t, err)
+		require.Len(t, open["BTC_RUB"], 1)
+
+		id := strconv.Itoa(int(order["order_id"].(float64)))
+		_, err = p.OrderCancel(id)
+		require.NoError(t, err)
+		require.InDelta(t, 1000000, paperBalance(t, p, "balances", "RUB"), 1e-6)
+		require.InDelta(t, 0, paperBalance(t, p, "reserved", "RUB"), 1e-6)
+
+		_, err = p.OrderCancel(id)
+		require.Equal(t, ErrOrderNotFound, err)
+	})
+
+	t.Run("LimitOrderPartialFillThenSync", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"BTC": 1})
+
+		// only the first bid level is at or above the limit price
+		order, err := p.Sell("BTC_RUB", "1", "999000")
+		require.NoError(t, err)
+		require.InDelta(t, 0.5, paperBalance(t, p, "reserved", "BTC"), 1e-9)
+		require.InDelta(t, 499500*0.996, paperBalance(t, p, "balances", "RUB"), 1e-6)
+
+		// the market moves up and the rest of the order fills as maker
+		market.books["BTC_RUB"] = `{"ask":[["1100000","1","1100000"]],"bid":[["1050000","2","2100000"]]}`
+		require.NoError(t, p.Sync())
+
+		open, _ := p.GetUserOpenOrders()
+		require.Empty(t, open)
+		require.InDelta(t, 0, paperBalance(t, p, "reserved", "BTC"), 1e-9)
+		require.InDelta(t, 499500*0.996+499500*0.998, paperBalance(t, p, "balances", "RUB"), 1e-6)
+
+		trades, err := p.GetOrderTrades(strconv.Itoa(int(order["order_id"].(float64))))
+		require.NoError(t, err)
+		require.Len(t, trades["trades"], 2)
+		require.Equal(t, "maker", trades["trades"].([]interface{})[1].(map[string]interface{})["exec_type"])
+	})
+}
@@ -0,0 +1,152 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// PostOnlyMode defines what happens to a post-only order that would take liquidity.
+type PostOnlyMode int
+
+const (
+	// PostOnlyReject doesn't send the order.
+	PostOnlyReject PostOnlyMode = iota
+	// PostOnlyReprice moves the price one tick inside the spread: below the best ask for buy,
+	// above the best bid for sell.
+	PostOnlyReprice
+)
+
+// PostOnlyAction is the decision made for a post-only order.
+type PostOnlyAction string
+
+const (
+	// PostOnlyPlaced means the order was sent at the requested price.
+	PostOnlyPlaced PostOnlyAction = "placed"
+	// PostOnlyRepriced means the order was sent at a price that doesn't cross the spread.
+	PostOnlyRepriced PostOnlyAction = "repriced"
+	// PostOnlyRejected means the order was not sent.
+	PostOnlyRejected PostOnlyAction = "rejected"
+)
+
+// PostOnlyDecision reports how a post-only order was treated.
+type PostOnlyDecision struct {
+	Action         PostOnlyAction
+	RequestedPrice string
+	Price          string // price the order was sent at, empty if rejected
+	BestBid        float64
+	BestAsk        float64
+	Reason         string
+}
+
+// DecidePostOnly checks that a limit order (buy or sell) at the price would rest in the book
+// as maker and, depending on the mode, rejects or reprices it otherwise.
+func DecidePostOnly(book OrderBook, settings PairSettings, price string, typeOrder string, mode PostOnlyMode) (PostOnlyDecision, error) {
+	d := PostOnlyDecision{RequestedPrice: price, Price: price}
+	p, err := strconv.ParseFloat(price, 64)
+	if err != nil || p <= 0 {
+		return d, fmt.Errorf("invalid price %q", price)
+	}
+	if len(book.Bid) > 0 {
+		d.BestBid = book.Bid[0].Price
+	}
+	if len(book.Ask) > 0 {
+		d.BestAsk = book.Ask[0].Price
+	}
+
+	var crosses bool
+	var inside float64
+	switch typeOrder {
+	case "buy":
+		crosses = d.BestAsk > 0 && p >= d.BestAsk
+		inside, _ = strconv.ParseFloat(settings.RoundPrice(d.BestAsk-settings.PriceTick(), RoundDown), 64)
+	case "sell":
+		crosses = d.BestBid > 0 && p <= d.BestBid
+		inside, _ = strconv.ParseFloat(settings.RoundPrice(d.BestBid+settings.PriceTick(), RoundUp), 64)
+	default:
+		return d, fmt.Errorf("post-only applies to limit orders, got %q", typeOrder)
+	}
+	if !crosses {
+		d.Action = PostOnlyPlaced
+		return d, nil
+	}
+
+	d.Reason = fmt.Sprintf("%s at %s would take liquidity, best bid %s, best ask %s",
+		typeOrder, price, formatFloat(d.BestBid), formatFloat(d.BestAsk))
+	// one tick inside the spread never crosses it, at worst it joins the best price of the own side
+	if mode == PostOnlyReprice && inside > 0 {
+		d.Action, d.Price = PostOnlyRepriced, formatFloat(inside)
+		return d, nil
+	}
+	d.Action, d.Price = PostOnlyRejected, ""
+	return d, nil
+}
+
+// PlacePostOnly sends a post-only limit order (buy or sell) with the trader after checking the order book.
+// Rejected orders are not sent, the response is nil then.
+func PlacePostOnly(trader Trader, market MarketData, pair, quantity, price, typeOrder string, mode PostOnlyMode) (ApiResponse, PostOnlyDecision, error) {
+	resp, err := market.GetPairSettings()
+	if err != nil {
+		return nil, PostOnlyDecision{}, err
+	}
+	settings, err := ParsePairSettings(resp)
+	if err != nil {
+		return nil, PostOnlyDecision{}, err
+	}
+	s, ok := settings[pair]
+	if !ok {
+		return nil, PostOnlyDecision{}, fmt.Errorf("unknown currency pair %s", pair)
+	}
+	return placePostOnly(trader, market, s, pair, quantity, price, typeOrder, mode)
+}
+
+func placePostOnly(trader Trader, market MarketData, settings PairSettings, pair, quantity, price, typeOrder string, mode PostOnlyMode) (ApiResponse, PostOnlyDecision, error) {
+	resp, err := market.GetOrderBook(pair, 100)
+	if err != nil {
+		return nil, PostOnlyDecision{}, err
+	}
+	book, err := ParseOrderBook(resp, pair)
+	if err != nil {
+		return nil, PostOnlyDecision{}, err
+	}
+	d, err := DecidePostOnly(book, settings, price, typeOrder, mode)
+	if err != nil || d.Action == PostOnlyRejected {
+		return nil, d, err
+	}
+
+	order, err := trader.OrderCreate(pair, quantity, d.Price, typeOrder)
+	return order, d, err
+}
+
+// BuyPostOnly creates buy order only if it rests in the book as maker, see DecidePostOnly.
+func (ex *Exmo) BuyPostOnly(pair string, quantity string, price string, mode PostOnlyMode) (ApiResponse, PostOnlyDecision, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return nil, PostOnlyDecision{}, err
+	}
+	return placePostOnly(ex, ex, settings, pair, quantity, price, "buy", mode)
+}
+
+// SellPostOnly creates sell order only if it rests in the book as maker, see DecidePostOnly.
+func (ex *Exmo) SellPostOnly(pair string, quantity string, price string, mode PostOnlyMode) (ApiResponse, PostOnlyDecision, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return nil, PostOnlyDecision{}, err
+	}
+	return placePostOnly(ex, ex, settings, pair, quantity, price, "sell", mode)
+}
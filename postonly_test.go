@@ -0,0 +1,96 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostOnly(t *testing.T) {
+	market := newStubMarket()
+	settings, err := ParsePairSettings(decodeResponse(testPairSettings))
+	require.NoError(t, err)
+	resp, _ := market.GetOrderBook("BTC_RUB", 100)
+	book, err := ParseOrderBook(resp, "BTC_RUB") // bid 999000, ask 1000000
+	require.NoError(t, err)
+
+	t.Run("Decide", func(t *testing.T) {
+		for _, c := range []struct {
+			price, typ string
+			mode       PostOnlyMode
+			action     PostOnlyAction
+			result     string
+		}{
+			{"999500", "buy", PostOnlyReject, PostOnlyPlaced, "999500"},
+			{"1000000", "buy", PostOnlyReject, PostOnlyRejected, ""},
+			{"1000500", "buy", PostOnlyReprice, PostOnlyRepriced, "999999.99"},
+			{"999500", "sell", PostOnlyReject, PostOnlyPlaced, "999500"},
+			{"999000", "sell", PostOnlyReject, PostOnlyRejected, ""},
+			{"990000", "sell", PostOnlyReprice, PostOnlyRepriced, "999000.01"},
+		} {
+			d, err := DecidePostOnly(book, settings["BTC_RUB"], c.price, c.typ, c.mode)
+			require.NoError(t, err)
+			require.Equal(t, c.action, d.Action, "%s at %s", c.typ, c.price)
+			require.Equal(t, c.result, d.Price, "%s at %s", c.typ, c.price)
+			require.Equal(t, c.price, d.RequestedPrice)
+		}
+
+		_, err := DecidePostOnly(book, settings["BTC_RUB"], "1000000", "market_buy", PostOnlyReject)
+		require.Error(t, err)
+	})
+
+	t.Run("Place", func(t *testing.T) {
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		order, d, err := PlacePostOnly(p, market, "BTC_RUB", "1", "1000000", "buy", PostOnlyReject)
+		require.NoError(t, err)
+		require.Nil(t, order)
+		require.Equal(t, PostOnlyRejected, d.Action)
+		require.NotEmpty(t, d.Reason)
+
+		order, d, err = PlacePostOnly(p, market, "BTC_RUB", "1", "1000000", "buy", PostOnlyReprice)
+		require.NoError(t, err)
+		require.NotNil(t, order)
+		require.Equal(t, PostOnlyRepriced, d.Action)
+		open, _ := p.GetUserOpenOrders()
+		require.Len(t, open["BTC_RUB"], 1)
+		require.InDelta(t, 999999.99, paperBalance(t, p, "reserved", "RUB"), 1e-6)
+	})
+
+	t.Run("Api", func(t *testing.T) {
+		var sent url.Values
+		api := stubApi(func(method string, params url.Values) string {
+			switch method {
+			case "pair_settings":
+				return testPairSettings
+			case "order_book":
+				return `{"BTC_RUB":` + market.books["BTC_RUB"] + `}`
+			case "order_create":
+				sent = params
+				return `{"result":true,"error":"","order_id":1}`
+			}
+			return `{}`
+		})
+		_, d, err := api.SellPostOnly("BTC_RUB", "0.1", "998000", PostOnlyReprice)
+		require.NoError(t, err)
+		require.Equal(t, PostOnlyRepriced, d.Action)
+		require.Equal(t, "999000.01", sent.Get("price"))
+		require.Equal(t, "sell", sent.Get("type"))
+	})
+}
@@ -0,0 +1,80 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimit is the number of requests per second allowed by the exchange for one client.
+const DefaultRateLimit = 10
+
+// RateLimiter spaces out requests evenly so that no more than the configured number is sent per second.
+// It is safe for concurrent use.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter creates limiter allowing perSecond requests per second.
+func NewRateLimiter(perSecond int) *RateLimiter {
+	if perSecond <= 0 {
+		perSecond = DefaultRateLimit
+	}
+	return &RateLimiter{interval: time.Second / time.Duration(perSecond)}
+}
+
+// Wait blocks until the next request is allowed or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// WithRateLimit limits the number of requests the client sends per second (DefaultRateLimit by default).
+// Zero or negative value disables limiting.
+func WithRateLimit(perSecond int) Option {
+	return func(ex *Exmo) {
+		if perSecond <= 0 {
+			ex.limiter = nil
+			return
+		}
+		ex.limiter = NewRateLimiter(perSecond)
+	}
+}
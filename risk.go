@@ -0,0 +1,349 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrKillSwitch is returned by RiskTrader for new orders while the kill switch is engaged.
+var ErrKillSwitch = errors.New("kill switch is engaged, new orders are blocked")
+
+// RiskLimits configures pre-trade checks of RiskTrader. Zero value of a limit disables its check.
+type RiskLimits struct {
+	// MaxNotional limits order amount per quote currency, e.g. {"RUB": 100000, "USD": 1500}. Market orders are
+	// valued at the best ticker price and rejected if the ticker has no price on their side.
+	MaxNotional map[string]float64
+	// MaxOpenOrdersPerPair is the maximal number of open orders of a pair, including the new one.
+	MaxOpenOrdersPerPair int
+	// MaxPosition limits holdings per currency (balance, reserved and what open orders will buy)
+	// after the order is filled, e.g. {"BTC": 1}.
+	MaxPosition map[string]float64
+	// MaxOrdersPerMinute is the maximal number of orders sent in any 60 seconds.
+	MaxOrdersPerMinute int
+	// PriceBandPercent is the maximal deviation of limit order price from the last trade price in the ticker.
+	PriceBandPercent float64
+}
+
+// RiskLimitError describes the limit that blocked an order.
+type RiskLimitError struct {
+	Pair  string
+	Rule  string // max_notional, max_open_orders, max_position, max_orders_per_minute or price_band
+	Value string // value the order would reach
+	Limit string
+}
+
+func (e *RiskLimitError) Error() string {
+	return fmt.Sprintf("%s order blocked: %s %s exceeds %s", e.Pair, e.Rule, e.Value, e.Limit)
+}
+
+// RiskTrader wraps a trader with pre-trade risk checks. Orders violating the limits are not sent and
+// *RiskLimitError is returned. Orders are checked and sent one at a time, so concurrent callers can't
+// exceed the limits together. Other methods are passed through. It is safe for concurrent use.
+type RiskTrader struct {
+	trader Trader
+	market MarketData
+	limits RiskLimits
+
+	killed int32 // kill switch, set atomically so that Kill doesn't wait for orders being checked
+
+	mu   sync.Mutex
+	sent []time.Time // times of orders sent during the last minute
+	now  func() time.Time
+}
+
+// NewRiskTrader creates trader checking orders against the limits. Market data is used for ticker prices.
+func NewRiskTrader(trader Trader, market MarketData, limits RiskLimits) *RiskTrader {
+	return &RiskTrader{trader: trader, market: market, limits: limits, now: time.Now}
+}
+
+// Kill engages the kill switch at once: all new orders fail with ErrKillSwitch until Resume is called,
+// including those already waiting for their turn to be checked. If cancelAll is set, Kill waits for
+// the order being sent at the moment, if any, and cancels all open orders.
+func (r *RiskTrader) Kill(ctx context.Context, cancelAll bool) (CancelReport, error) {
+	atomic.StoreInt32(&r.killed, 1)
+
+	if !cancelAll {
+		return CancelReport{}, nil
+	}
+	r.mu.Lock()
+	r.mu.Unlock()
+	return CancelOrders(ctx, r.trader, nil, 0)
+}
+
+// Resume disengages the kill switch.
+func (r *RiskTrader) Resume() {
+	atomic.StoreInt32(&r.killed, 0)
+}
+
+// Killed reports whether the kill switch is engaged.
+func (r *RiskTrader) Killed() bool {
+	return atomic.LoadInt32(&r.killed) == 1
+}
+
+// OrderCreate checks the order against the limits and sends it.
+func (r *RiskTrader) OrderCreate(pair string, quantity string, price string, typeOrder string) (ApiResponse, error) {
+	return r.OrderCreateWithClientId(pair, quantity, price, typeOrder, 0)
+}
+
+// OrderCreateWithClientId checks the order against the limits and sends it tagged with client order id.
+func (r *RiskTrader) OrderCreateWithClientId(pair string, quantity string, price string, typeOrder string, clientId int64) (ApiResponse, error) {
+	if r.Killed() {
+		return nil, ErrKillSwitch
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.check(pair, quantity, price, typeOrder); err != nil {
+		return nil, err
+	}
+	// the switch may have been engaged while the order waited for its turn or was checked
+	if r.Killed() {
+		return nil, ErrKillSwitch
+	}
+	if r.limits.MaxOrdersPerMinute > 0 {
+		r.sent = append(r.sent, r.now())
+	}
+	if clientId == 0 {
+		// leave it to the trader, it may generate ids itself
+		return r.trader.OrderCreate(pair, quantity, price, typeOrder)
+	}
+	return r.trader.OrderCreateWithClientId(pair, quantity, price, typeOrder, clientId)
+}
+
+// Buy creates buy order checked against the limits.
+func (r *RiskTrader) Buy(pair string, quantity string, price string) (ApiResponse, error) {
+	return r.OrderCreate(pair, quantity, price, "buy")
+}
+
+// Sell creates sell order checked against the limits.
+func (r *RiskTrader) Sell(pair string, quantity string, price string) (ApiResponse, error) {
+	return r.OrderCreate(pair, quantity, price, "sell")
+}
+
+// MarketBuy creates market buy order checked against the limits.
+func (r *RiskTrader) MarketBuy(pair string, quantity string) (ApiResponse, error) {
+	return r.OrderCreate(pair, quantity, "0", "market_buy")
+}
+
+// MarketBuyTotal creates market buy order for the amount of quote currency checked against the limits.
+func (r *RiskTrader) MarketBuyTotal(pair string, quantity string) (ApiResponse, error) {
+	return r.OrderCreate(pair, quantity, "0", "market_buy_total")
+}
+
+// MarketSell creates market sell order checked against the limits.
+func (r *RiskTrader) MarketSell(pair string, quantity string) (ApiResponse, error) {
+	return r.OrderCreate(pair, quantity, "0", "market_sell")
+}
+
+// MarketSellTotal creates market sell order for the amount of quote currency checked against the limits.
+func (r *RiskTrader) MarketSellTotal(pair string, quantity string) (ApiResponse, error) {
+	return r.OrderCreate(pair, quantity, "0", "market_sell_total")
+}
+
+// OrderCancel cancels the order, it is allowed while the kill switch is engaged.
+func (r *RiskTrader) OrderCancel(orderId string) (ApiResponse, error) {
+	return r.trader.OrderCancel(orderId)
+}
+
+// GetUserOpenOrders returns open orders of the wrapped trader.
+func (r *RiskTrader) GetUserOpenOrders() (ApiResponse, error) {
+	return r.trader.GetUserOpenOrders()
+}
+
+// GetUserInfo returns balances of the wrapped trader.
+func (r *RiskTrader) GetUserInfo() (ApiResponse, error) {
+	return r.trader.GetUserInfo()
+}
+
+// GetOrderTrades returns trades of the order.
+func (r *RiskTrader) GetOrderTrades(orderId string) (ApiResponse, error) {
+	return r.trader.GetOrderTrades(orderId)
+}
+
+// check runs the checks in order of their cost: local ones first, then those requesting the ticker and the account.
+func (r *RiskTrader) check(pair, quantity, price, typeOrder string) error {
+	base, quote, err := SplitPair(pair)
+	if err != nil {
+		return err
+	}
+	q, err := strconv.ParseFloat(quantity, 64)
+	if err != nil || q <= 0 {
+		return fmt.Errorf("invalid quantity %q", quantity)
+	}
+	var p float64
+	limit := typeOrder == "buy" || typeOrder == "sell"
+	if limit {
+		if p, err = strconv.ParseFloat(price, 64); err != nil || p <= 0 {
+			return fmt.Errorf("invalid price %q", price)
+		}
+	}
+
+	if max := r.limits.MaxOrdersPerMinute; max > 0 {
+		cutoff := r.now().Add(-time.Minute)
+		i := 0
+		for i < len(r.sent) && !r.sent[i].After(cutoff) {
+			i++
+		}
+		r.sent = r.sent[i:]
+		if len(r.sent)+1 > max {
+			return &RiskLimitError{Pair: pair, Rule: "max_orders_per_minute", Value: strconv.Itoa(len(r.sent) + 1), Limit: strconv.Itoa(max)}
+		}
+	}
+
+	needTicker := r.limits.PriceBandPercent > 0 && limit ||
+		(len(r.limits.MaxNotional) > 0 || len(r.limits.MaxPosition) > 0) && !limit
+	var ticker TickerItem
+	if needTicker {
+		resp, err := r.market.Ticker()
+		if err != nil {
+			return err
+		}
+		all, err := ParseTicker(resp)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if ticker, ok = all[pair]; !ok {
+			return fmt.Errorf("no ticker for %s", pair)
+		}
+	}
+
+	if band := r.limits.PriceBandPercent; band > 0 && limit && ticker.LastTrade > 0 {
+		deviation := math.Abs(p-ticker.LastTrade) / ticker.LastTrade * 100
+		if deviation > band {
+			return &RiskLimitError{Pair: pair, Rule: "price_band", Value: formatFloat(math.Round(deviation*100)/100) + "%", Limit: formatFloat(band) + "%"}
+		}
+	}
+
+	// base and quote amounts the order trades, market orders are valued at the best price on their side
+	if needTicker && !limit {
+		side := ticker.SellPrice
+		if typeOrder == "market_sell" || typeOrder == "market_sell_total" {
+			side = ticker.BuyPrice
+		}
+		if side <= 0 {
+			return fmt.Errorf("no price to value %s order in ticker for %s", typeOrder, pair)
+		}
+	}
+	var baseAmount, quoteAmount float64
+	switch typeOrder {
+	case "buy", "sell":
+		baseAmount, quoteAmount = q, q*p
+	case "market_buy":
+		baseAmount, quoteAmount = q, q*ticker.SellPrice
+	case "market_sell":
+		baseAmount, quoteAmount = q, q*ticker.BuyPrice
+	case "market_buy_total":
+		quoteAmount = q
+		if ticker.SellPrice > 0 {
+			baseAmount = q / ticker.SellPrice
+		}
+	case "market_sell_total":
+		quoteAmount = q
+		if ticker.BuyPrice > 0 {
+			baseAmount = q / ticker.BuyPrice
+		}
+	default:
+		return fmt.Errorf("unknown order type %q", typeOrder)
+	}
+
+	if max, ok := r.limits.MaxNotional[quote]; ok && quoteAmount > max {
+		return &RiskLimitError{Pair: pair, Rule: "max_notional", Value: formatFloat(quoteAmount) + " " + quote, Limit: formatFloat(max) + " " + quote}
+	}
+
+	if r.limits.MaxOpenOrdersPerPair <= 0 && len(r.limits.MaxPosition) == 0 {
+		return nil
+	}
+	resp, err := r.trader.GetUserOpenOrders()
+	if err != nil {
+		return err
+	}
+	open, err := ParseOpenOrders(resp)
+	if err != nil {
+		return err
+	}
+
+	if max := r.limits.MaxOpenOrdersPerPair; max > 0 && limit {
+		count := 1
+		for _, o := range open {
+			if o.Pair == pair {
+				count++
+			}
+		}
+		if count > max {
+			return &RiskLimitError{Pair: pair, Rule: "max_open_orders", Value: strconv.Itoa(count), Limit: strconv.Itoa(max)}
+		}
+	}
+
+	// the order increases holdings of the currency it buys
+	currency, amount := base, baseAmount
+	if typeOrder == "sell" || typeOrder == "market_sell" || typeOrder == "market_sell_total" {
+		currency, amount = quote, quoteAmount
+	}
+	max, ok := r.limits.MaxPosition[currency]
+	if !ok {
+		return nil
+	}
+	position, err := r.position(currency, open)
+	if err != nil {
+		return err
+	}
+	if position+amount > max {
+		return &RiskLimitError{Pair: pair, Rule: "max_position", Value: formatFloat(position+amount) + " " + currency, Limit: formatFloat(max) + " " + currency}
+	}
+	return nil
+}
+
+// position returns balance and reserved amount of the currency and what open orders will buy of it.
+func (r *RiskTrader) position(currency string, open []OpenOrder) (float64, error) {
+	info, err := r.trader.GetUserInfo()
+	if err != nil {
+		return 0, err
+	}
+	balances, err := parseAmounts(info["balances"])
+	if err != nil {
+		return 0, fmt.Errorf("balances: %s", err)
+	}
+	reserved, err := parseAmounts(info["reserved"])
+	if err != nil {
+		return 0, fmt.Errorf("reserved: %s", err)
+	}
+
+	position := balances[currency] + reserved[currency]
+	for _, o := range open {
+		base, quote, err := SplitPair(o.Pair)
+		if err != nil {
+			continue
+		}
+		switch {
+		case o.Type == "buy" && base == currency:
+			position += o.Quantity
+		case o.Type == "sell" && quote == currency:
+			position += o.Amount
+		}
+	}
+	return position, nil
+}
@@ -0,0 +1,244 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ Trader = &RiskTrader{}
+
+func requireRiskRule(t *testing.T, err error, rule string) {
+	require.Error(t, err)
+	limitErr, ok := err.(*RiskLimitError)
+	require.True(t, ok, "unexpected error %v", err)
+	require.Equal(t, rule, limitErr.Rule)
+}
+
+// slowTrader blocks in OrderCreate until released and counts orders it sent.
+type slowTrader struct {
+	*Paper
+	entered chan struct{}
+	release chan struct{}
+	sent    int32
+}
+
+func (s *slowTrader) OrderCreate(pair string, quantity string, price string, typeOrder string) (ApiResponse, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	atomic.AddInt32(&s.sent, 1)
+	return s.Paper.OrderCreate(pair, quantity, price, typeOrder)
+}
+
+func (s *slowTrader) Buy(pair string, quantity string, price string) (ApiResponse, error) {
+	return s.OrderCreate(pair, quantity, price, "buy")
+}
+
+func TestRiskTrader(t *testing.T) {
+	market := newStubMarket() // BTC_RUB last trade 999500, bid 999000, ask 1000000
+
+	t.Run("Notional", func(t *testing.T) {
+		p := NewPaper(market, map[string]float64{"RUB": 10000000, "BTC": 10})
+		r := NewRiskTrader(p, market, RiskLimits{MaxNotional: map[string]float64{"RUB": 500000, "BTC": 0.001}})
+
+		_, err := r.Buy("BTC_RUB", "0.5", "990000")
+		require.NoError(t, err)
+		_, err = r.Buy("BTC_RUB", "0.6", "990000")
+		requireRiskRule(t, err, "max_notional")
+		_, err = r.MarketSell("BTC_RUB", "0.6") // 0.6 * 999000
+		requireRiskRule(t, err, "max_notional")
+		_, err = r.MarketBuyTotal("BTC_RUB", "600000")
+		requireRiskRule(t, err, "max_notional")
+		_, err = r.MarketBuyTotal("BTC_RUB", "400000")
+		require.NoError(t, err)
+
+		// the limit is per quote currency: 0.1 ETH costs 0.002 BTC
+		_, err = r.Buy("ETH_BTC", "0.1", "0.02")
+		requireRiskRule(t, err, "max_notional")
+		_, err = r.Buy("ETH_RUB", "1", "20000")
+		require.NoError(t, err)
+	})
+
+	t.Run("NotionalNoPrice", func(t *testing.T) {
+		// market orders can't be valued without price on their side of the ticker
+		empty := newStubMarket()
+		empty.ticker = `{"BTC_RUB": {"buy_price":"0","sell_price":"1000000","last_trade":"999500","updated":1570000000}}`
+		p := NewPaper(market, map[string]float64{"BTC": 10})
+		r := NewRiskTrader(p, empty, RiskLimits{MaxNotional: map[string]float64{"RUB": 500000}})
+
+		_, err := r.MarketSell("BTC_RUB", "1")
+		require.Error(t, err)
+		_, err = r.MarketSellTotal("BTC_RUB", "100000")
+		require.Error(t, err)
+		require.Empty(t, p.trades)
+	})
+
+	t.Run("OpenOrders", func(t *testing.T) {
+		p := NewPaper(market, map[string]float64{"RUB": 10000000})
+		r := NewRiskTrader(p, market, RiskLimits{MaxOpenOrdersPerPair: 2})
+
+		for i := 0; i < 2; i++ {
+			_, err := r.Buy("BTC_RUB", "0.1", "900000")
+			require.NoError(t, err)
+		}
+		_, err := r.Buy("BTC_RUB", "0.1", "900000")
+		requireRiskRule(t, err, "max_open_orders")
+		_, err = r.Buy("ETH_RUB", "1", "19000")
+		require.NoError(t, err)
+	})
+
+	t.Run("Position", func(t *testing.T) {
+		p := NewPaper(market, map[string]float64{"RUB": 10000000, "BTC": 0.5})
+		r := NewRiskTrader(p, market, RiskLimits{MaxPosition: map[string]float64{"BTC": 1}})
+
+		_, err := r.Buy("BTC_RUB", "0.3", "900000") // rests in the book
+		require.NoError(t, err)
+		_, err = r.Buy("BTC_RUB", "0.3", "900000") // 0.5 held and 0.3 ordered already
+		requireRiskRule(t, err, "max_position")
+		_, err = r.MarketBuy("BTC_RUB", "0.2")
+		require.NoError(t, err)
+		// selling BTC is not limited
+		_, err = r.MarketSell("BTC_RUB", "0.5")
+		require.NoError(t, err)
+	})
+
+	t.Run("Rate", func(t *testing.T) {
+		p := NewPaper(market, map[string]float64{"RUB": 10000000})
+		r := NewRiskTrader(p, market, RiskLimits{MaxOrdersPerMinute: 3})
+		now := time.Now()
+		r.now = func() time.Time { return now }
+
+		for i := 0; i < 3; i++ {
+			_, err := r.Buy("BTC_RUB", "0.1", "900000")
+			require.NoError(t, err)
+			now = now.Add(10 * time.Second)
+		}
+		_, err := r.Buy("BTC_RUB", "0.1", "900000")
+		requireRiskRule(t, err, "max_orders_per_minute")
+
+		now = now.Add(31 * time.Second) // the first order is more than a minute old
+		_, err = r.Buy("BTC_RUB", "0.1", "900000")
+		require.NoError(t, err)
+		_, err = r.Buy("BTC_RUB", "0.1", "900000")
+		requireRiskRule(t, err, "max_orders_per_minute")
+	})
+
+	t.Run("PriceBand", func(t *testing.T) {
+		p := NewPaper(market, map[string]float64{"RUB": 10000000, "BTC": 1})
+		r := NewRiskTrader(p, market, RiskLimits{PriceBandPercent: 5})
+
+		_, err := r.Buy("BTC_RUB", "0.1", "950000")
+		require.NoError(t, err)
+		_, err = r.Buy("BTC_RUB", "0.1", "940000")
+		requireRiskRule(t, err, "price_band")
+		require.Equal(t, "BTC_RUB order blocked: price_band 5.95% exceeds 5%", err.Error())
+		_, err = r.Sell("BTC_RUB", "0.1", "1100000")
+		requireRiskRule(t, err, "price_band")
+		// market orders have no price to check
+		_, err = r.MarketBuy("BTC_RUB", "0.1")
+		require.NoError(t, err)
+	})
+
+	t.Run("KillSwitch", func(t *testing.T) {
+		p := NewPaper(market, map[string]float64{"RUB": 10000000})
+		r := NewRiskTrader(p, market, RiskLimits{})
+		for i := 0; i < 3; i++ {
+			_, err := r.Buy("BTC_RUB", "0.1", "900000")
+			require.NoError(t, err)
+		}
+
+		report, err := r.Kill(context.Background(), false)
+		require.NoError(t, err)
+		require.Zero(t, report.Cancelled)
+		require.True(t, r.Killed())
+		_, err = r.MarketBuy("BTC_RUB", "0.1")
+		require.Equal(t, ErrKillSwitch, err)
+		open, _ := r.GetUserOpenOrders()
+		require.Len(t, open["BTC_RUB"], 3)
+
+		report, err = r.Kill(context.Background(), true)
+		require.NoError(t, err)
+		require.Equal(t, 3, report.Cancelled)
+		open, _ = r.GetUserOpenOrders()
+		require.Empty(t, open)
+
+		r.Resume()
+		require.False(t, r.Killed())
+		_, err = r.Buy("BTC_RUB", "0.1", "900000")
+		require.NoError(t, err)
+	})
+
+	t.Run("KillQueued", func(t *testing.T) {
+		slow := &slowTrader{
+			Paper:   NewPaper(market, map[string]float64{"RUB": 10000000}),
+			entered: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		r := NewRiskTrader(slow, market, RiskLimits{MaxNotional: map[string]float64{"RUB": 1000000}})
+
+		const n = 10
+		errs := make(chan error, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := r.Buy("BTC_RUB", "0.1", "900000")
+				errs <- err
+			}()
+		}
+		<-slow.entered // one order is being sent, the others wait for their turn
+		time.Sleep(50 * time.Millisecond)
+
+		killed := make(chan struct{})
+		go func() {
+			r.Kill(context.Background(), false)
+			close(killed)
+		}()
+		select {
+		case <-killed:
+		case <-time.After(time.Second):
+			t.Fatal("Kill waits for orders being sent")
+		}
+		require.True(t, r.Killed())
+
+		close(slow.release)
+		wg.Wait()
+		close(errs)
+		var blocked int
+		for err := range errs {
+			if err == ErrKillSwitch {
+				blocked++
+			} else {
+				require.NoError(t, err)
+			}
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&slow.sent))
+		require.Equal(t, n-1, blocked)
+
+		// cancelling waits for the order sent before the switch and cancels it too
+		report, err := r.Kill(context.Background(), true)
+		require.NoError(t, err)
+		require.Equal(t, 1, report.Cancelled)
+	})
+}
@@ -0,0 +1,115 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// RoundingMode defines direction of rounding to a tick or step.
+type RoundingMode int
+
+const (
+	// RoundDown rounds towards negative infinity (floor).
+	RoundDown RoundingMode = iota
+	// RoundUp rounds towards positive infinity (ceil).
+	RoundUp
+	// RoundNearest rounds to the nearest step, half away from zero.
+	RoundNearest
+)
+
+// QuantityPrecision is the number of decimal places accepted by the exchange in order quantity.
+const QuantityPrecision = 8
+
+// PriceTick returns the minimal price increment of the pair.
+func (s PairSettings) PriceTick() float64 {
+	if s.PricePrecision < 0 {
+		return math.Pow10(-QuantityPrecision)
+	}
+	return math.Pow10(-s.PricePrecision)
+}
+
+// QuantityStep returns the minimal quantity increment of the pair.
+func (s PairSettings) QuantityStep() float64 {
+	return math.Pow10(-QuantityPrecision)
+}
+
+// RoundPrice rounds price to the tick of the pair and formats it for OrderCreate.
+func (s PairSettings) RoundPrice(price float64, mode RoundingMode) string {
+	return RoundToStep(price, s.PriceTick(), mode)
+}
+
+// RoundQuantity rounds quantity to the step of the pair and formats it for OrderCreate.
+func (s PairSettings) RoundQuantity(quantity float64, mode RoundingMode) string {
+	return RoundToStep(quantity, s.QuantityStep(), mode)
+}
+
+// RoundPrice rounds price to the tick of the pair using cached pair settings.
+func (ex *Exmo) RoundPrice(pair string, price float64, mode RoundingMode) (string, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return "", err
+	}
+	return settings.RoundPrice(price, mode), nil
+}
+
+// RoundQuantity rounds quantity to the step of the pair using cached pair settings.
+func (ex *Exmo) RoundQuantity(pair string, quantity float64, mode RoundingMode) (string, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return "", err
+	}
+	return settings.RoundQuantity(quantity, mode), nil
+}
+
+// RoundToStep rounds value to a multiple of step and formats it without exponent and trailing zeros.
+func RoundToStep(value float64, step float64, mode RoundingMode) string {
+	if step <= 0 {
+		return formatFloat(value)
+	}
+
+	n := value / step
+	// absorb binary representation error, so that 0.29/0.01 = 28.999999999999996 is not floored to 28
+	if r := math.Round(n); math.Abs(n-r) < 1e-9*math.Max(1, math.Abs(n)) {
+		n = r
+	}
+	switch mode {
+	case RoundDown:
+		n = math.Floor(n)
+	case RoundUp:
+		n = math.Ceil(n)
+	default:
+		n = math.Round(n)
+	}
+
+	return trimZeros(strconv.FormatFloat(n*step, 'f', decimals(step), 64))
+}
+
+// trimZeros removes trailing zeros of the fractional part, e.g. "1.2300" becomes "1.23" and "5.00" becomes "5".
+func trimZeros(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
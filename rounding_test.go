@@ -0,0 +1,75 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRounding(t *testing.T) {
+	t.Run("RoundToStep", func(t *testing.T) {
+		for _, tc := range []struct {
+			value float64
+			step  float64
+			mode  RoundingMode
+			want  string
+		}{
+			{50096.123456, 0.01, RoundDown, "50096.12"},
+			{50096.123456, 0.01, RoundUp, "50096.13"},
+			{50096.125, 0.01, RoundNearest, "50096.13"},
+			{50096.124, 0.01, RoundNearest, "50096.12"},
+			{0.29, 0.01, RoundDown, "0.29"},
+			{0.29, 0.01, RoundUp, "0.29"},
+			{1.5, 1, RoundDown, "1"},
+			{12.37, 0.05, RoundNearest, "12.35"},
+			{0.000000015, 1e-8, RoundDown, "0.00000001"},
+			{50096.1, 0.01, RoundDown, "50096.1"},
+			{0.001, 0.01, RoundDown, "0"},
+		} {
+			require.Equal(t, tc.want, RoundToStep(tc.value, tc.step, tc.mode), "%v/%v", tc.value, tc.step)
+		}
+	})
+
+	t.Run("PairSettings", func(t *testing.T) {
+		settings, err := ParsePairSettings(decodeResponse(testPairSettings))
+		require.NoError(t, err)
+
+		require.Equal(t, "50096.12", settings["BTC_RUB"].RoundPrice(50096.123456, RoundDown))
+		require.Equal(t, "0.019877", settings["ETH_BTC"].RoundPrice(0.0198765, RoundNearest))
+		require.Equal(t, "0.12345679", settings["BTC_RUB"].RoundQuantity(0.123456789, RoundUp))
+
+		// rounded values pass validation
+		quantity := settings["BTC_RUB"].RoundQuantity(0.0123456789, RoundDown)
+		price := settings["BTC_RUB"].RoundPrice(1000000.987, RoundDown)
+		_, _, err = ValidateOrder(settings["BTC_RUB"], "BTC_RUB", quantity, price, "buy")
+		require.NoError(t, err)
+	})
+
+	t.Run("Exmo", func(t *testing.T) {
+		api := stubApi(func(method string, params url.Values) string { return testPairSettings })
+
+		price, err := api.RoundPrice("BTC_RUB", 50096.123456, RoundUp)
+		require.NoError(t, err)
+		require.Equal(t, "50096.13", price)
+
+		_, err = api.RoundQuantity("XRP_RUB", 1, RoundDown)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,175 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// OrderSize is the result of fee-aware order sizing.
+type OrderSize struct {
+	Quantity   string  // quantity param for the order (amount in quote currency for market_buy_total)
+	Gross      float64 // base currency bought before commission
+	Commission float64 // commission in base currency, the exchange charges it in the received currency
+	Net        float64 // base currency received after commission
+	Cost       float64 // quote currency spent
+}
+
+// CommissionPercent returns the commission an order of the type may be charged. Market orders pay taker
+// commission, and so may limit orders: they fill as taker when they cross the spread. Use CommissionMakerPercent
+// for orders known to rest in the book, e.g. placed with BuyPostOnly.
+func (s PairSettings) CommissionPercent(typeOrder string) float64 {
+	return s.CommissionTakerPercent
+}
+
+// SizeBuyForBudget computes buy order (buy, market_buy or market_buy_total) that spends no more than budget
+// of quote currency at the price (expected average fill price for market orders). Commission is taken at
+// the taker rate, see SizeMakerBuyForBudget for limit orders resting in the book.
+func (s PairSettings) SizeBuyForBudget(typeOrder string, budget float64, price float64) (OrderSize, error) {
+	fee, err := s.buyCommission(typeOrder, price, false)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return s.sizeForBudget(typeOrder, budget, price, fee), nil
+}
+
+// SizeMakerBuyForBudget computes limit buy order that is filled as maker (e.g. placed with BuyPostOnly)
+// and spends no more than budget of quote currency at the price.
+func (s PairSettings) SizeMakerBuyForBudget(budget float64, price float64) (OrderSize, error) {
+	fee, err := s.buyCommission("buy", price, true)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return s.sizeForBudget("buy", budget, price, fee), nil
+}
+
+func (s PairSettings) sizeForBudget(typeOrder string, budget float64, price float64, fee float64) OrderSize {
+
+	var size OrderSize
+	if typeOrder == "market_buy_total" {
+		size.Quantity = s.RoundPrice(budget, RoundDown)
+		size.Cost, _ = strconv.ParseFloat(size.Quantity, 64)
+		size.Gross = size.Cost / price
+	} else {
+		size.Quantity = s.RoundQuantity(budget/price, RoundDown)
+		size.Gross, _ = strconv.ParseFloat(size.Quantity, 64)
+		size.Cost = size.Gross * price
+	}
+	size.Commission = size.Gross * fee / 100
+	size.Net = size.Gross - size.Commission
+
+	return size
+}
+
+// SizeBuyForNet computes buy order (buy, market_buy or market_buy_total) that delivers at least net
+// quantity of base currency after commission at the price (expected average fill price for market orders).
+// Commission is taken at the taker rate, so the net quantity is delivered even if a limit order crosses
+// the spread; see SizeMakerBuyForNet for limit orders resting in the book.
+func (s PairSettings) SizeBuyForNet(typeOrder string, net float64, price float64) (OrderSize, error) {
+	fee, err := s.buyCommission(typeOrder, price, false)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return s.sizeForNet(typeOrder, net, price, fee), nil
+}
+
+// SizeMakerBuyForNet computes limit buy order that is filled as maker (e.g. placed with BuyPostOnly)
+// and delivers at least net quantity of base currency after commission at the price.
+func (s PairSettings) SizeMakerBuyForNet(net float64, price float64) (OrderSize, error) {
+	fee, err := s.buyCommission("buy", price, true)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return s.sizeForNet("buy", net, price, fee), nil
+}
+
+func (s PairSettings) sizeForNet(typeOrder string, net float64, price float64, fee float64) OrderSize {
+
+	var size OrderSize
+	gross := net / (1 - fee/100)
+	if typeOrder == "market_buy_total" {
+		size.Quantity = s.RoundPrice(gross*price, RoundUp)
+		size.Cost, _ = strconv.ParseFloat(size.Quantity, 64)
+		size.Gross = size.Cost / price
+	} else {
+		size.Quantity = s.RoundQuantity(gross, RoundUp)
+		size.Gross, _ = strconv.ParseFloat(size.Quantity, 64)
+		size.Cost = size.Gross * price
+	}
+	size.Commission = size.Gross * fee / 100
+	size.Net = size.Gross - size.Commission
+
+	return size
+}
+
+func (s PairSettings) buyCommission(typeOrder string, price float64, maker bool) (float64, error) {
+	switch typeOrder {
+	case "buy", "market_buy", "market_buy_total":
+	default:
+		return 0, fmt.Errorf("can't size %q order, only buy orders are supported", typeOrder)
+	}
+	if price <= 0 {
+		return 0, fmt.Errorf("invalid price %v", price)
+	}
+	fee := s.CommissionPercent(typeOrder)
+	if maker {
+		fee = s.CommissionMakerPercent
+	}
+	if fee < 0 || fee >= 100 {
+		return 0, fmt.Errorf("invalid commission %v%%", fee)
+	}
+	return fee, nil
+}
+
+// SizeBuyForBudget computes fee-aware buy order for the pair using cached pair settings, see PairSettings.SizeBuyForBudget.
+func (ex *Exmo) SizeBuyForBudget(pair string, typeOrder string, budget float64, price float64) (OrderSize, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return settings.SizeBuyForBudget(typeOrder, budget, price)
+}
+
+// SizeBuyForNet computes fee-aware buy order for the pair using cached pair settings, see PairSettings.SizeBuyForNet.
+func (ex *Exmo) SizeBuyForNet(pair string, typeOrder string, net float64, price float64) (OrderSize, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return settings.SizeBuyForNet(typeOrder, net, price)
+}
+
+// SizeMakerBuyForBudget computes fee-aware resting limit buy order for the pair using cached pair settings,
+// see PairSettings.SizeMakerBuyForBudget.
+func (ex *Exmo) SizeMakerBuyForBudget(pair string, budget float64, price float64) (OrderSize, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return settings.SizeMakerBuyForBudget(budget, price)
+}
+
+// SizeMakerBuyForNet computes fee-aware resting limit buy order for the pair using cached pair settings,
+// see PairSettings.SizeMakerBuyForNet.
+func (ex *Exmo) SizeMakerBuyForNet(pair string, net float64, price float64) (OrderSize, error) {
+	settings, err := ex.CachedPairSettings(pair)
+	if err != nil {
+		return OrderSize{}, err
+	}
+	return settings.SizeMakerBuyForNet(net, price)
+}
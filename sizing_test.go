@@ -0,0 +1,98 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizing(t *testing.T) {
+	settings, err := ParsePairSettings(decodeResponse(testPairSettings))
+	require.NoError(t, err)
+	btc := settings["BTC_RUB"] // maker 0.2%, taker 0.4%
+
+	t.Run("BudgetLimit", func(t *testing.T) {
+		// a limit order may cross the spread and pay taker commission
+		size, err := btc.SizeBuyForBudget("buy", 100000, 3000000)
+		require.NoError(t, err)
+		require.Equal(t, "0.03333333", size.Quantity)
+		require.True(t, size.Cost <= 100000)
+		require.InDelta(t, 0.03333333*0.996, size.Net, 1e-12)
+
+		size, err = btc.SizeMakerBuyForBudget(100000, 3000000)
+		require.NoError(t, err)
+		require.Equal(t, "0.03333333", size.Quantity)
+		require.InDelta(t, 0.03333333*0.998, size.Net, 1e-12)
+	})
+
+	t.Run("NetLimit", func(t *testing.T) {
+		// the net quantity is delivered even if the order fills as taker
+		size, err := btc.SizeBuyForNet("buy", 0.1, 1000000)
+		require.NoError(t, err)
+		require.Equal(t, "0.10040161", size.Quantity)
+		require.True(t, size.Net >= 0.1)
+
+		size, err = btc.SizeMakerBuyForNet(0.1, 1000000)
+		require.NoError(t, err)
+		require.Equal(t, "0.10020041", size.Quantity)
+		require.True(t, size.Net >= 0.1)
+	})
+
+	t.Run("BudgetMarketTotal", func(t *testing.T) {
+		size, err := btc.SizeBuyForBudget("market_buy_total", 100000.129, 1000000)
+		require.NoError(t, err)
+		require.Equal(t, "100000.12", size.Quantity)
+		require.InDelta(t, 0.10000012*0.996, size.Net, 1e-12)
+	})
+
+	t.Run("NetMarket", func(t *testing.T) {
+		size, err := btc.SizeBuyForNet("market_buy", 0.1, 1000000)
+		require.NoError(t, err)
+		require.Equal(t, "0.10040161", size.Quantity)
+		require.True(t, size.Net >= 0.1)
+		require.True(t, size.Net-0.1 < 1e-8)
+	})
+
+	t.Run("NetMarketTotal", func(t *testing.T) {
+		size, err := btc.SizeBuyForNet("market_buy_total", 0.1, 1000000)
+		require.NoError(t, err)
+		total, _ := strconv.ParseFloat(size.Quantity, 64)
+		require.True(t, size.Net >= 0.1)
+		require.InDelta(t, 100401.61, total, 1e-9)
+	})
+
+	t.Run("PaperFill", func(t *testing.T) {
+		// sized market order fills on the paper client without leftover quote balance
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 400000})
+		size, err := btc.SizeBuyForBudget("market_buy_total", 400000, 1000000)
+		require.NoError(t, err)
+		_, err = p.MarketBuyTotal("BTC_RUB", size.Quantity)
+		require.NoError(t, err)
+		require.InDelta(t, 0, paperBalance(t, p, "balances", "RUB"), 1e-6)
+		require.InDelta(t, size.Net, paperBalance(t, p, "balances", "BTC"), 1e-12)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := btc.SizeBuyForBudget("sell", 1, 1)
+		require.Error(t, err)
+		_, err = btc.SizeBuyForNet("buy", 1, 0)
+		require.Error(t, err)
+	})
+}
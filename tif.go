@@ -0,0 +1,231 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TimeInForce defines how long a limit order stays in the book. The exchange keeps orders until cancelled,
+// other policies are emulated client-side.
+type TimeInForce string
+
+const (
+	// GoodTillCancel keeps the order until it is filled or cancelled.
+	GoodTillCancel TimeInForce = "gtc"
+	// ImmediateOrCancel fills what is possible at once and cancels the rest.
+	ImmediateOrCancel TimeInForce = "ioc"
+	// FillOrKill is sent only if the book has enough volume at the price to fill the whole order,
+	// any remainder (if the book changes meanwhile) is cancelled at once.
+	FillOrKill TimeInForce = "fok"
+	// GoodTillTime keeps the order until the expiry time, then a scheduler cancels it.
+	GoodTillTime TimeInForce = "gtt"
+)
+
+// TimeInForceResult is the outcome of placing an order with time in force.
+type TimeInForceResult struct {
+	OrderId     string
+	TimeInForce TimeInForce
+	Filled      float64 // base currency filled before the remainder was cancelled (IOC and FOK)
+	Cancelled   bool    // the remainder was cancelled
+	Rejected    bool    // FOK order was not sent, Reason says why
+	Reason      string
+	ExpiresAt   time.Time // GTT
+}
+
+// TimeInForceTrader places limit orders with time in force. It is safe for concurrent use.
+type TimeInForceTrader struct {
+	trader    Trader
+	market    MarketData
+	scheduler *ExpiryScheduler
+}
+
+// NewTimeInForceTrader creates trader placing orders with the trader. Market data is used for FOK depth checks.
+func NewTimeInForceTrader(trader Trader, market MarketData) *TimeInForceTrader {
+	return &TimeInForceTrader{trader: trader, market: market, scheduler: NewExpiryScheduler(trader)}
+}
+
+// Scheduler returns the scheduler cancelling GTT orders.
+func (t *TimeInForceTrader) Scheduler() *ExpiryScheduler {
+	return t.scheduler
+}
+
+// Place creates limit order (typeOrder is buy or sell) with time in force. expiresAt is used by GTT only.
+func (t *TimeInForceTrader) Place(pair, quantity, price, typeOrder string, tif TimeInForce, expiresAt time.Time) (TimeInForceResult, error) {
+	result := TimeInForceResult{TimeInForce: tif}
+	if typeOrder != "buy" && typeOrder != "sell" {
+		return result, fmt.Errorf("time in force applies to limit orders, got %q", typeOrder)
+	}
+
+	switch tif {
+	case GoodTillCancel, ImmediateOrCancel:
+	case FillOrKill:
+		ok, reason, err := t.fillable(pair, quantity, price, typeOrder)
+		if err != nil {
+			return result, err
+		}
+		if !ok {
+			result.Rejected, result.Reason = true, reason
+			return result, nil
+		}
+	case GoodTillTime:
+		if !expiresAt.After(time.Now()) {
+			return result, fmt.Errorf("expiry time %s is in the past", expiresAt.Format(time.RFC3339))
+		}
+		result.ExpiresAt = expiresAt
+	default:
+		return result, fmt.Errorf("unknown time in force %q", tif)
+	}
+
+	resp, err := t.trader.OrderCreate(pair, quantity, price, typeOrder)
+	if err != nil {
+		return result, err
+	}
+	if result.OrderId, err = orderIdOf(resp); err != nil {
+		return result, err
+	}
+
+	switch tif {
+	case GoodTillTime:
+		t.scheduler.Schedule(result.OrderId, expiresAt)
+	case ImmediateOrCancel, FillOrKill:
+		_, err := t.trader.OrderCancel(result.OrderId)
+		switch {
+		case err == nil:
+			result.Cancelled = true
+		case !isOrderNotFound(err):
+			return result, err
+		}
+		// not found means the order didn't rest in the book, i.e. it was filled completely
+		trades, err := fetchOrderTrades(t.trader, result.OrderId)
+		if err != nil {
+			return result, err
+		}
+		result.Filled = filledBase(trades)
+	}
+	return result, nil
+}
+
+// Close stops the scheduler, GTT orders that haven't expired yet stay in the book.
+func (t *TimeInForceTrader) Close() {
+	t.scheduler.Stop()
+}
+
+// fillable checks the book has enough volume at the price or better for the whole quantity.
+func (t *TimeInForceTrader) fillable(pair, quantity, price, typeOrder string) (bool, string, error) {
+	q, err := strconv.ParseFloat(quantity, 64)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid quantity %q", quantity)
+	}
+	p, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid price %q", price)
+	}
+	resp, err := t.market.GetOrderBook(pair, 1000)
+	if err != nil {
+		return false, "", err
+	}
+	book, err := ParseOrderBook(resp, pair)
+	if err != nil {
+		return false, "", err
+	}
+
+	var fills []BookLevel
+	if typeOrder == "buy" {
+		fills = takeLiquidity(append([]BookLevel(nil), book.Ask...), q, false, func(level float64) bool { return level <= p })
+	} else {
+		fills = takeLiquidity(append([]BookLevel(nil), book.Bid...), q, false, func(level float64) bool { return level >= p })
+	}
+	if available := filledQuantity(fills, false); available < q-epsilon {
+		return false, "only " + formatFloat(available) + " available at " + price + " or better", nil
+	}
+	return true, "", nil
+}
+
+// ExpiryScheduler cancels orders at their expiry time in the background. It is safe for concurrent use.
+type ExpiryScheduler struct {
+	trader Trader
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+
+	// OnCancel, if set, is called after the cancel request of an expired order with its error
+	// (e.g. the order was filled before it expired).
+	OnCancel func(orderId string, err error)
+}
+
+// NewExpiryScheduler creates scheduler cancelling orders with the trader.
+func NewExpiryScheduler(trader Trader) *ExpiryScheduler {
+	return &ExpiryScheduler{trader: trader, timers: map[string]*time.Timer{}}
+}
+
+// Schedule cancels the order at the time, replacing its previous schedule.
+func (s *ExpiryScheduler) Schedule(orderId string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if timer, ok := s.timers[orderId]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(at), func() {
+		s.mu.Lock()
+		if s.timers[orderId] != timer {
+			// rescheduled or unscheduled meanwhile
+			s.mu.Unlock()
+			return
+		}
+		delete(s.timers, orderId)
+		s.mu.Unlock()
+
+		_, err := s.trader.OrderCancel(orderId)
+		if s.OnCancel != nil {
+			s.OnCancel(orderId, err)
+		}
+	})
+	s.timers[orderId] = timer
+}
+
+// Unschedule keeps the order in the book, false if it was not scheduled.
+func (s *ExpiryScheduler) Unschedule(orderId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timer, ok := s.timers[orderId]
+	if ok {
+		timer.Stop()
+		delete(s.timers, orderId)
+	}
+	return ok
+}
+
+// Pending returns the number of orders waiting for expiry.
+func (s *ExpiryScheduler) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.timers)
+}
+
+// Stop unschedules all orders.
+func (s *ExpiryScheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for orderId, timer := range s.timers {
+		timer.Stop()
+		delete(s.timers, orderId)
+	}
+}
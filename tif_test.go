@@ -0,0 +1,96 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeInForce(t *testing.T) {
+	t.Run("IOC", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		tif := NewTimeInForceTrader(p, market)
+
+		// only the first ask level is at the price
+		result, err := tif.Place("BTC_RUB", "1", "1000000", "buy", ImmediateOrCancel, time.Time{})
+		require.NoError(t, err)
+		require.Equal(t, 0.5, result.Filled)
+		require.True(t, result.Cancelled)
+
+		open, _ := p.GetUserOpenOrders()
+		require.Empty(t, open)
+		require.InDelta(t, 1500000, paperBalance(t, p, "balances", "RUB"), 1e-6)
+	})
+
+	t.Run("FOK", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		tif := NewTimeInForceTrader(p, market)
+
+		result, err := tif.Place("BTC_RUB", "1", "1000000", "buy", FillOrKill, time.Time{})
+		require.NoError(t, err)
+		require.True(t, result.Rejected)
+		require.Equal(t, "only 0.5 available at 1000000 or better", result.Reason)
+		require.Empty(t, result.OrderId)
+		require.InDelta(t, 2000000, paperBalance(t, p, "balances", "RUB"), 1e-6)
+
+		result, err = tif.Place("BTC_RUB", "1", "1001000", "buy", FillOrKill, time.Time{})
+		require.NoError(t, err)
+		require.False(t, result.Rejected)
+		require.False(t, result.Cancelled)
+		require.Equal(t, 1.0, result.Filled)
+	})
+
+	t.Run("GTT", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"RUB": 2000000})
+		tif := NewTimeInForceTrader(p, market)
+		defer tif.Close()
+
+		cancelled := make(chan string, 1)
+		tif.Scheduler().OnCancel = func(orderId string, err error) {
+			require.NoError(t, err)
+			cancelled <- orderId
+		}
+
+		result, err := tif.Place("BTC_RUB", "1", "900000", "buy", GoodTillTime, time.Now().Add(20*time.Millisecond))
+		require.NoError(t, err)
+		require.Equal(t, 1, tif.Scheduler().Pending())
+		open, _ := p.GetUserOpenOrders()
+		require.Len(t, open["BTC_RUB"], 1)
+
+		require.Equal(t, result.OrderId, <-cancelled)
+		require.Equal(t, 0, tif.Scheduler().Pending())
+		open, _ = p.GetUserOpenOrders()
+		require.Empty(t, open)
+
+		// unscheduled order stays in the book
+		result, err = tif.Place("BTC_RUB", "1", "900000", "buy", GoodTillTime, time.Now().Add(20*time.Millisecond))
+		require.NoError(t, err)
+		require.True(t, tif.Scheduler().Unschedule(result.OrderId))
+		time.Sleep(40 * time.Millisecond)
+		open, _ = p.GetUserOpenOrders()
+		require.Len(t, open["BTC_RUB"], 1)
+
+		_, err = tif.Place("BTC_RUB", "1", "900000", "buy", GoodTillTime, time.Now().Add(-time.Second))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,368 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OrderState is the state of a tracked order.
+type OrderState int
+
+const (
+	// OrderNew is the state of an order not polled yet.
+	OrderNew OrderState = iota
+	// OrderOpen is resting in the book without fills.
+	OrderOpen
+	// OrderPartiallyFilled is resting in the book with some fills.
+	OrderPartiallyFilled
+	// OrderFilled is filled completely, the final state.
+	OrderFilled
+	// OrderCancelled is removed from the book before it was filled completely (possibly with some fills), the final state.
+	OrderCancelled
+)
+
+func (s OrderState) String() string {
+	switch s {
+	case OrderNew:
+		return "new"
+	case OrderOpen:
+		return "open"
+	case OrderPartiallyFilled:
+		return "partially_filled"
+	case OrderFilled:
+		return "filled"
+	case OrderCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// Final reports whether the order can't change anymore.
+func (s OrderState) Final() bool {
+	return s == OrderFilled || s == OrderCancelled
+}
+
+// OrderEventType is the kind of change of a tracked order.
+type OrderEventType int
+
+const (
+	// EventPartialFill is emitted when an open order gets new trades.
+	EventPartialFill OrderEventType = iota
+	// EventFill is emitted when an order is filled completely.
+	EventFill
+	// EventCancel is emitted when an order leaves the book unfilled or partially filled.
+	EventCancel
+)
+
+func (t OrderEventType) String() string {
+	switch t {
+	case EventPartialFill:
+		return "partial_fill"
+	case EventFill:
+		return "fill"
+	case EventCancel:
+		return "cancel"
+	default:
+		return "unknown"
+	}
+}
+
+// OrderEvent is a change of a tracked order.
+type OrderEvent struct {
+	Type      OrderEventType
+	OrderId   string
+	Pair      string
+	State     OrderState  // state after the event
+	Quantity  float64     // order quantity, 0 if unknown
+	Filled    float64     // base currency filled so far
+	Remaining float64     // Quantity - Filled
+	Trades    []UserTrade // trades made since the previous event
+	Time      time.Time
+}
+
+// OrderTracker follows many orders by polling open orders and turns their changes into events. A single
+// GetUserOpenOrders request per poll tells which orders changed: trades are requested only for orders whose
+// open quantity changed or that left the book. It is safe for concurrent use.
+type OrderTracker struct {
+	trader Trader
+	mu     sync.Mutex
+	orders map[string]*trackedOrder
+
+	// Interval is the pause between polls in Run, 1 second by default.
+	Interval time.Duration
+}
+
+type trackedOrder struct {
+	id       string
+	pair     string
+	quantity float64
+	filled   float64
+	state    OrderState
+	trades   map[int64]bool
+	open     float64 // open quantity seen on the previous poll, 0 if not seen in the book yet
+}
+
+// NewOrderTracker creates tracker polling the trader.
+func NewOrderTracker(trader Trader) *OrderTracker {
+	return &OrderTracker{trader: trader, orders: map[string]*trackedOrder{}, Interval: time.Second}
+}
+
+// Track starts tracking the order. Quantity is the order quantity in base currency, if zero it is taken
+// from open orders on the first poll.
+func (t *OrderTracker) Track(orderId string, pair string, quantity float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.orders[orderId]; !ok {
+		t.orders[orderId] = &trackedOrder{id: orderId, pair: pair, quantity: quantity, trades: map[int64]bool{}}
+	}
+}
+
+// Untrack stops tracking the order without emitting events.
+func (t *OrderTracker) Untrack(orderId string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.orders, orderId)
+}
+
+// State returns the current state of the tracked order. Orders are untracked once they reach the final state.
+func (t *OrderTracker) State(orderId string) (OrderState, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	order, ok := t.orders[orderId]
+	if !ok {
+		return OrderNew, false
+	}
+	return order.state, true
+}
+
+// Len returns the number of tracked orders.
+func (t *OrderTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.orders)
+}
+
+// Run polls every Interval and sends events to the channel until the context is done or a poll fails.
+// Events found by the failed poll are sent before the error is returned. The channel is not closed.
+func (t *OrderTracker) Run(ctx context.Context, events chan<- OrderEvent) error {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		found, err := t.Poll()
+		for _, e := range found {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		timer.Reset(interval)
+	}
+}
+
+// Poll requests open orders once, then trades of the orders that changed, and returns events ordered by order id.
+// Orders reaching the final state are untracked. If trades of an order can't be requested, the order is left
+// as it was to be checked on the next poll, and the events of other orders are returned with the first error.
+func (t *OrderTracker) Poll() ([]OrderEvent, error) {
+	resp, err := t.trader.GetUserOpenOrders()
+	if err != nil {
+		return nil, err
+	}
+	list, err := ParseOpenOrders(resp)
+	if err != nil {
+		return nil, err
+	}
+	open := make(map[string]OpenOrder, len(list))
+	for _, o := range list {
+		open[o.OrderId] = o
+	}
+
+	t.mu.Lock()
+	orders := make([]*trackedOrder, 0, len(t.orders))
+	changed := make(map[*trackedOrder]bool, len(t.orders))
+	for _, order := range t.orders {
+		orders = append(orders, order)
+		o, isOpen := open[order.id]
+		changed[order] = !isOpen || !order.unchanged(o)
+	}
+	t.mu.Unlock()
+	sort.Slice(orders, func(i, j int) bool { return lessOrderId(orders[i].id, orders[j].id) })
+
+	var events []OrderEvent
+	var firstErr error
+	now := time.Now()
+	for _, order := range orders {
+		var trades []UserTrade
+		if changed[order] {
+			if trades, err = fetchOrderTrades(t.trader, order.id); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		}
+
+		t.mu.Lock()
+		if t.orders[order.id] != order {
+			// untracked meanwhile
+			t.mu.Unlock()
+			continue
+		}
+		o, isOpen := open[order.id]
+		if isOpen {
+			order.open = o.Quantity
+		}
+		if e, ok := order.update(trades, o, isOpen); ok {
+			e.Time = now
+			events = append(events, e)
+		}
+		if order.state.Final() {
+			delete(t.orders, order.id)
+		}
+		t.mu.Unlock()
+	}
+	return events, firstErr
+}
+
+// unchanged reports whether the open order had no fills since the previous poll: its open quantity is the same
+// as then, or as the tracked quantity on the first poll. Orders of unknown quantity are checked on the first poll.
+// Caller must hold the lock.
+func (order *trackedOrder) unchanged(o OpenOrder) bool {
+	const tolerance = 1e-9
+	known := order.open
+	if known == 0 && order.filled == 0 {
+		known = order.quantity
+	}
+	return known > 0 && math.Abs(o.Quantity-known) <= known*tolerance
+}
+
+// fetchOrderTrades returns trades of the order; orders without trades are reported as not found by the exchange.
+func fetchOrderTrades(trader Trader, orderId string) ([]UserTrade, error) {
+	resp, err := trader.GetOrderTrades(orderId)
+	if isOrderNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list, _ := resp["trades"].([]interface{})
+	trades, err := parseTradeList(list)
+	if err != nil {
+		return nil, fmt.Errorf("order trades of %s: %s", orderId, err)
+	}
+	return trades, nil
+}
+
+// update moves the order to the next state and returns the event of the transition, if any.
+func (order *trackedOrder) update(trades []UserTrade, o OpenOrder, isOpen bool) (OrderEvent, bool) {
+	var fresh []UserTrade
+	for _, trade := range trades {
+		if !order.trades[trade.TradeId] {
+			order.trades[trade.TradeId] = true
+			order.filled += trade.Quantity
+			fresh = append(fresh, trade)
+		}
+		if order.pair == "" {
+			order.pair = trade.Pair
+		}
+	}
+	if isOpen {
+		if order.pair == "" {
+			order.pair = o.Pair
+		}
+		if order.quantity == 0 && order.filled == 0 {
+			order.quantity = o.Quantity
+		}
+	}
+
+	var event OrderEventType
+	switch {
+	case isOpen && order.filled > 0:
+		order.state = OrderPartiallyFilled
+		if len(fresh) == 0 {
+			return OrderEvent{}, false
+		}
+		event = EventPartialFill
+	case isOpen:
+		order.state = OrderOpen
+		return OrderEvent{}, false
+	case order.filled > 0 && (order.quantity == 0 || order.filled >= order.quantity*(1-1e-9)):
+		order.state = OrderFilled
+		event = EventFill
+	default:
+		order.state = OrderCancelled
+		event = EventCancel
+	}
+
+	e := OrderEvent{
+		Type:     event,
+		OrderId:  order.id,
+		Pair:     order.pair,
+		State:    order.state,
+		Quantity: order.quantity,
+		Filled:   order.filled,
+		Trades:   fresh,
+	}
+	if order.quantity > 0 {
+		e.Remaining = order.quantity - order.filled
+		if e.Remaining < 0 || order.state == OrderFilled {
+			e.Remaining = 0
+		}
+	}
+	return e, true
+}
+
+// isOrderNotFound reports whether the error means the exchange has no such order (or no trades of it).
+func isOrderNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return err == ErrOrderNotFound || strings.Contains(strings.ToLower(err.Error()), "not found")
+}
+
+// lessOrderId orders numeric ids by value and others lexicographically.
+func lessOrderId(a, b string) bool {
+	x, errA := strconv.ParseInt(a, 10, 64)
+	y, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		return x < y
+	}
+	return a < b
+}
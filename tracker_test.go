@@ -0,0 +1,246 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingPaper counts GetOrderTrades requests.
+type countingPaper struct {
+	*Paper
+	tradeRequests int32
+}
+
+func (p *countingPaper) GetOrderTrades(orderId string) (ApiResponse, error) {
+	atomic.AddInt32(&p.tradeRequests, 1)
+	return p.Paper.GetOrderTrades(orderId)
+}
+
+// failingTradesPaper fails GetOrderTrades of the order while fail is set.
+type failingTradesPaper struct {
+	*Paper
+	orderId string
+	fail    int32
+}
+
+func (p *failingTradesPaper) GetOrderTrades(orderId string) (ApiResponse, error) {
+	if orderId == p.orderId && atomic.LoadInt32(&p.fail) == 1 {
+		return nil, errors.New("connection reset")
+	}
+	return p.Paper.GetOrderTrades(orderId)
+}
+
+func TestOrderTracker(t *testing.T) {
+	t.Run("Lifecycle", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"BTC": 1, "RUB": 1000000})
+		tracker := NewOrderTracker(p)
+
+		// half of the order fills immediately, the rest rests in the book
+		resp, err := p.Sell("BTC_RUB", "1", "999000")
+		require.NoError(t, err)
+		sell, _ := orderIdOf(resp)
+		tracker.Track(sell, "BTC_RUB", 1)
+
+		resp, err = p.Buy("BTC_RUB", "1", "900000")
+		require.NoError(t, err)
+		buy, _ := orderIdOf(resp)
+		tracker.Track(buy, "", 0)
+
+		events, err := tracker.Poll()
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, EventPartialFill, events[0].Type)
+		require.Equal(t, sell, events[0].OrderId)
+		require.Equal(t, 0.5, events[0].Filled)
+		require.Equal(t, 0.5, events[0].Remaining)
+		require.Len(t, events[0].Trades, 1)
+		state, _ := tracker.State(buy)
+		require.Equal(t, OrderOpen, state)
+
+		// nothing changed
+		events, err = tracker.Poll()
+		require.NoError(t, err)
+		require.Empty(t, events)
+
+		// the rest of the sell order fills and the buy order is cancelled
+		market.books["BTC_RUB"] = `{"ask":[["1100000","1","1100000"]],"bid":[["1050000","2","2100000"]]}`
+		require.NoError(t, p.Sync())
+		_, err = p.OrderCancel(buy)
+		require.NoError(t, err)
+
+		events, err = tracker.Poll()
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, EventFill, events[0].Type)
+		require.Equal(t, OrderFilled, events[0].State)
+		require.Equal(t, 1.0, events[0].Filled)
+		require.Len(t, events[0].Trades, 1)
+
+		require.Equal(t, EventCancel, events[1].Type)
+		require.Equal(t, "BTC_RUB", events[1].Pair)
+		require.Equal(t, 1.0, events[1].Quantity)
+		require.Equal(t, 0.0, events[1].Filled)
+		require.Equal(t, 0, tracker.Len())
+	})
+
+	t.Run("ManyOrders", func(t *testing.T) {
+		market := newStubMarket()
+		p := &countingPaper{Paper: NewPaper(market, map[string]float64{"RUB": 100000000})}
+		tracker := NewOrderTracker(p)
+
+		var ids []string
+		for i := 0; i < 100; i++ {
+			resp, err := p.Buy("BTC_RUB", "0.1", strconv.Itoa(900000+i))
+			require.NoError(t, err)
+			id, _ := orderIdOf(resp)
+			tracker.Track(id, "BTC_RUB", 0.1)
+			ids = append(ids, id)
+		}
+
+		// resting orders are checked with open orders only
+		for i := 0; i < 2; i++ {
+			events, err := tracker.Poll()
+			require.NoError(t, err)
+			require.Empty(t, events)
+		}
+		require.Zero(t, atomic.LoadInt32(&p.tradeRequests))
+
+		// trades are requested only for the order that left the book
+		_, err := p.OrderCancel(ids[10])
+		require.NoError(t, err)
+		events, err := tracker.Poll()
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, EventCancel, events[0].Type)
+		require.Equal(t, int32(1), atomic.LoadInt32(&p.tradeRequests))
+		require.Equal(t, 99, tracker.Len())
+	})
+
+	t.Run("PartiallyFilledCancel", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"BTC": 1})
+		tracker := NewOrderTracker(p)
+
+		resp, err := p.Sell("BTC_RUB", "1", "999000")
+		require.NoError(t, err)
+		id, _ := orderIdOf(resp)
+		tracker.Track(id, "BTC_RUB", 1)
+		_, err = p.OrderCancel(id)
+		require.NoError(t, err)
+
+		events, err := tracker.Poll()
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, EventCancel, events[0].Type)
+		require.Equal(t, 0.5, events[0].Filled)
+		require.Equal(t, 0.5, events[0].Remaining)
+	})
+
+	t.Run("TradesError", func(t *testing.T) {
+		p := &failingTradesPaper{Paper: NewPaper(newStubMarket(), map[string]float64{"RUB": 1000000})}
+		tracker := NewOrderTracker(p)
+
+		var ids []string
+		for _, price := range []string{"900000", "900001", "900002"} {
+			resp, err := p.Buy("BTC_RUB", "0.1", price)
+			require.NoError(t, err)
+			id, _ := orderIdOf(resp)
+			tracker.Track(id, "BTC_RUB", 0.1)
+			_, err = p.OrderCancel(id)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+
+		// trades of the second order can't be requested: events of the others are returned with the error
+		p.orderId = ids[1]
+		atomic.StoreInt32(&p.fail, 1)
+		events, err := tracker.Poll()
+		require.Error(t, err)
+		require.Len(t, events, 2)
+		require.Equal(t, ids[0], events[0].OrderId)
+		require.Equal(t, ids[2], events[1].OrderId)
+		state, ok := tracker.State(ids[1])
+		require.True(t, ok)
+		require.Equal(t, OrderNew, state)
+
+		// the failed order is checked again on the next poll
+		atomic.StoreInt32(&p.fail, 0)
+		events, err = tracker.Poll()
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, ids[1], events[0].OrderId)
+		require.Equal(t, EventCancel, events[0].Type)
+		require.Equal(t, 0, tracker.Len())
+	})
+
+	t.Run("RunError", func(t *testing.T) {
+		p := &failingTradesPaper{Paper: NewPaper(newStubMarket(), map[string]float64{"RUB": 1000000})}
+		tracker := NewOrderTracker(p)
+
+		var ids []string
+		for _, price := range []string{"900000", "900001"} {
+			resp, err := p.Buy("BTC_RUB", "0.1", price)
+			require.NoError(t, err)
+			id, _ := orderIdOf(resp)
+			tracker.Track(id, "BTC_RUB", 0.1)
+			_, err = p.OrderCancel(id)
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		p.orderId = ids[1]
+		atomic.StoreInt32(&p.fail, 1)
+
+		// the event found before the failure is sent, then the error is returned
+		events := make(chan OrderEvent, 2)
+		err := tracker.Run(context.Background(), events)
+		require.Error(t, err)
+		require.Len(t, events, 1)
+		e := <-events
+		require.Equal(t, ids[0], e.OrderId)
+		require.Equal(t, 1, tracker.Len())
+	})
+
+	t.Run("Run", func(t *testing.T) {
+		p := NewPaper(newStubMarket(), map[string]float64{"RUB": 1000000})
+		tracker := NewOrderTracker(p)
+		tracker.Interval = time.Millisecond
+
+		resp, err := p.Buy("BTC_RUB", "1", "900000")
+		require.NoError(t, err)
+		id, _ := orderIdOf(resp)
+		tracker.Track(id, "BTC_RUB", 1)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events := make(chan OrderEvent)
+		go tracker.Run(ctx, events)
+
+		_, err = p.OrderCancel(id)
+		require.NoError(t, err)
+		e := <-events
+		require.Equal(t, EventCancel, e.Type)
+		require.Equal(t, id, e.OrderId)
+	})
+}
@@ -0,0 +1,468 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TriggerType defines the price condition of a trigger.
+type TriggerType string
+
+const (
+	// TriggerStopLoss fires when the price moves against the position to Price: a sell trigger
+	// at or below it, a buy trigger at or above it.
+	TriggerStopLoss TriggerType = "stop_loss"
+	// TriggerTakeProfit fires when the price moves in favour of the position to Price: a sell trigger
+	// at or above it, a buy trigger at or below it.
+	TriggerTakeProfit TriggerType = "take_profit"
+	// TriggerTrailingStop follows the best price seen and fires when the price retreats from it by TrailPercent.
+	TriggerTrailingStop TriggerType = "trailing_stop"
+	// TriggerLimitOrder is a limit order resting on the exchange (OrderId) as a member of OCO group. It fires
+	// when the order gets its first fill, and the order is cancelled when a sibling fires.
+	TriggerLimitOrder TriggerType = "limit_order"
+)
+
+// TriggerState is the state of a trigger.
+type TriggerState string
+
+const (
+	// TriggerActive is watching the price.
+	TriggerActive TriggerState = "active"
+	// TriggerFiring is placing its order. A trigger found in this state on load was interrupted
+	// and is marked failed, since the order may or may not have been placed.
+	TriggerFiring TriggerState = "firing"
+	// TriggerFired has placed its order, the final state.
+	TriggerFired TriggerState = "fired"
+	// TriggerCancelled was cancelled or its OCO sibling fired, the final state.
+	TriggerCancelled TriggerState = "cancelled"
+	// TriggerFailed couldn't place its order (or cancel the limit order of TriggerLimitOrder), the final state.
+	TriggerFailed TriggerState = "failed"
+)
+
+// Trigger places a market order when the price condition is met. Sell triggers watch the best bid,
+// buy triggers watch the best ask.
+type Trigger struct {
+	Id           string       `json:"id"`
+	Group        string       `json:"group,omitempty"` // OCO group: when a trigger fires, the rest of the group is cancelled
+	Pair         string       `json:"pair"`
+	Side         string       `json:"side"` // buy or sell
+	Type         TriggerType  `json:"type"`
+	Quantity     string       `json:"quantity"` // quantity of the market (or limit) order in base currency
+	Price        float64      `json:"price,omitempty"`
+	TrailPercent float64      `json:"trail_percent,omitempty"`
+	Extreme      float64      `json:"extreme,omitempty"` // the best price seen by trailing stop
+	State        TriggerState `json:"state"`
+	FiredPrice   float64      `json:"fired_price,omitempty"`
+	OrderId      string       `json:"order_id,omitempty"` // order placed by the trigger, or the limit order of TriggerLimitOrder
+	Error        string       `json:"error,omitempty"`
+	Created      time.Time    `json:"created"`
+	Updated      time.Time    `json:"updated"`
+}
+
+// TriggerEngine watches ticker prices and fires triggers client-side. The state of triggers is saved
+// to a file after every change, so trailing extremes and OCO groups survive restarts. It is safe for concurrent use.
+type TriggerEngine struct {
+	trader   Trader
+	market   MarketData
+	path     string
+	tracker  *OrderTracker // follows limit orders of TriggerLimitOrder triggers
+	mu       sync.Mutex
+	triggers map[string]*Trigger
+
+	// Interval is the pause between price checks in Run, 1 second by default.
+	Interval time.Duration
+}
+
+// NewTriggerEngine creates engine placing orders with the trader and loads triggers saved in the file.
+// Empty path disables persistence.
+func NewTriggerEngine(trader Trader, market MarketData, path string) (*TriggerEngine, error) {
+	e := &TriggerEngine{trader: trader, market: market, path: path, tracker: NewOrderTracker(trader), triggers: map[string]*Trigger{},
+		Interval: time.Second}
+	if path == "" {
+		return e, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return e, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var triggers []*Trigger
+	if err := json.Unmarshal(data, &triggers); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	interrupted := false
+	for _, t := range triggers {
+		if t.State == TriggerFiring {
+			t.State, t.Error = TriggerFailed, "interrupted while placing the order, check open orders and trades"
+			interrupted = true
+		}
+		e.triggers[t.Id] = t
+		e.track(t)
+	}
+	if interrupted {
+		if err := e.save(); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Add validates the trigger and starts watching it. Id is generated if empty.
+func (e *TriggerEngine) Add(t Trigger) (Trigger, error) {
+	added, err := e.add([]Trigger{t}, "")
+	if err != nil {
+		return Trigger{}, err
+	}
+	return added[0], nil
+}
+
+// AddOCO adds triggers as one-cancels-the-others group, e.g. stop loss and take profit of a position.
+// Limit orders already placed on the exchange join the group as TriggerLimitOrder triggers.
+func (e *TriggerEngine) AddOCO(triggers ...Trigger) ([]Trigger, error) {
+	if len(triggers) < 2 {
+		return nil, fmt.Errorf("OCO group needs at least two triggers")
+	}
+	return e.add(triggers, "oco-"+strconv.FormatInt(NewClientId(), 10))
+}
+
+func (e *TriggerEngine) add(triggers []Trigger, group string) ([]Trigger, error) {
+	now := time.Now().UTC()
+	for i := range triggers {
+		t := &triggers[i]
+		if err := t.validate(); err != nil {
+			return nil, err
+		}
+		if t.Id == "" {
+			t.Id = strconv.FormatInt(NewClientId(), 10)
+		}
+		if group != "" {
+			t.Group = group
+		} else if t.Type == TriggerLimitOrder {
+			return nil, fmt.Errorf("limit order trigger must be added with AddOCO")
+		}
+		t.State, t.Extreme, t.Created, t.Updated = TriggerActive, 0, now, now
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, t := range triggers {
+		if _, ok := e.triggers[t.Id]; ok {
+			return nil, fmt.Errorf("trigger %s already exists", t.Id)
+		}
+	}
+	for i := range triggers {
+		t := triggers[i]
+		e.triggers[t.Id] = &t
+		e.track(&t)
+	}
+	return triggers, e.save()
+}
+
+func (t *Trigger) validate() error {
+	if _, _, err := SplitPair(t.Pair); err != nil {
+		return err
+	}
+	if t.Side != "buy" && t.Side != "sell" {
+		return fmt.Errorf("invalid side %q", t.Side)
+	}
+	if q, err := strconv.ParseFloat(t.Quantity, 64); err != nil || q <= 0 {
+		return fmt.Errorf("invalid quantity %q", t.Quantity)
+	}
+	switch t.Type {
+	case TriggerStopLoss, TriggerTakeProfit:
+		if t.Price <= 0 {
+			return fmt.Errorf("invalid price %v", t.Price)
+		}
+	case TriggerTrailingStop:
+		if t.TrailPercent <= 0 || t.TrailPercent >= 100 {
+			return fmt.Errorf("invalid trail percent %v", t.TrailPercent)
+		}
+	case TriggerLimitOrder:
+		if t.OrderId == "" {
+			return fmt.Errorf("limit order trigger needs order id")
+		}
+	default:
+		return fmt.Errorf("invalid trigger type %q", t.Type)
+	}
+	return nil
+}
+
+// Cancel stops watching the trigger. The limit order of TriggerLimitOrder is left in the book.
+func (e *TriggerEngine) Cancel(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.triggers[id]
+	if !ok {
+		return fmt.Errorf("trigger %s not found", id)
+	}
+	if t.State != TriggerActive {
+		return fmt.Errorf("trigger %s is %s", id, t.State)
+	}
+	t.State, t.Updated = TriggerCancelled, time.Now().UTC()
+	e.untrack(t)
+	return e.save()
+}
+
+// Triggers returns all triggers ordered by creation.
+func (e *TriggerEngine) Triggers() []Trigger {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.sorted()
+}
+
+// Run checks prices every Interval and sends triggers that fired or failed to the channel until the context
+// is done or the ticker or limit orders can't be read. The channel is not closed.
+func (e *TriggerEngine) Run(ctx context.Context, fired chan<- Trigger) error {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		found, err := e.Check()
+		for _, t := range found {
+			select {
+			case fired <- t:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err != nil {
+			return err
+		}
+		timer.Reset(interval)
+	}
+}
+
+// Check polls limit orders of OCO groups, then requests the ticker once, updates trailing stops and fires
+// triggers whose condition is met. It returns triggers that fired or failed to place (or cancel) their orders.
+func (e *TriggerEngine) Check() ([]Trigger, error) {
+	var events []OrderEvent
+	var pollErr error
+	if e.tracker.Len() > 0 {
+		events, pollErr = e.tracker.Poll()
+	}
+	resp, err := e.market.Ticker()
+	if err != nil {
+		return nil, err
+	}
+	ticker, err := ParseTicker(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var changed []Trigger
+	dirty := len(events) > 0
+	for _, event := range events {
+		changed = append(changed, e.filled(event)...)
+	}
+	for _, t := range e.sorted() {
+		t := e.triggers[t.Id]
+		if t.State != TriggerActive {
+			continue
+		}
+		item, ok := ticker[t.Pair]
+		if !ok {
+			continue
+		}
+		price := item.BuyPrice
+		if t.Side == "buy" {
+			price = item.SellPrice
+		}
+		if price <= 0 {
+			continue
+		}
+
+		fire, moved := t.evaluate(price)
+		dirty = dirty || moved
+		if !fire {
+			continue
+		}
+
+		// the state is saved before the order is sent, so that a crash can't make the trigger fire twice
+		t.State, t.FiredPrice, t.Updated = TriggerFiring, price, time.Now().UTC()
+		if err := e.save(); err != nil {
+			return changed, err
+		}
+		e.fire(t)
+		changed = append(changed, *t)
+		if t.State == TriggerFired {
+			changed = append(changed, e.cancelGroup(t)...)
+		}
+		dirty = true
+	}
+
+	if dirty {
+		if err := e.save(); err != nil {
+			return changed, err
+		}
+	}
+	return changed, pollErr
+}
+
+// evaluate checks the condition at the price; moved reports the trailing extreme was updated.
+func (t *Trigger) evaluate(price float64) (fire bool, moved bool) {
+	sell := t.Side == "sell"
+	switch t.Type {
+	case TriggerStopLoss:
+		return sell && price <= t.Price || !sell && price >= t.Price, false
+	case TriggerTakeProfit:
+		return sell && price >= t.Price || !sell && price <= t.Price, false
+	case TriggerTrailingStop:
+		if t.Extreme == 0 || sell && price > t.Extreme || !sell && price < t.Extreme {
+			t.Extreme, t.Updated = price, time.Now().UTC()
+			return false, true
+		}
+		if sell {
+			return price <= t.Extreme*(1-t.TrailPercent/100), false
+		}
+		return price >= t.Extreme*(1+t.TrailPercent/100), false
+	}
+	return false, false
+}
+
+// fire places the market order of the trigger. Caller must hold the lock.
+func (e *TriggerEngine) fire(t *Trigger) {
+	var resp ApiResponse
+	var err error
+	if t.Side == "sell" {
+		resp, err = e.trader.MarketSell(t.Pair, t.Quantity)
+	} else {
+		resp, err = e.trader.MarketBuy(t.Pair, t.Quantity)
+	}
+	if err == nil {
+		t.OrderId, err = orderIdOf(resp)
+	}
+	t.Updated = time.Now().UTC()
+	if err != nil {
+		t.State, t.Error = TriggerFailed, err.Error()
+		return
+	}
+	t.State = TriggerFired
+}
+
+// filled applies the tracker event to its limit order trigger: the trigger fires on the first fill of
+// the order and cancels its OCO group. It returns triggers that fired or failed. Caller must hold the lock.
+func (e *TriggerEngine) filled(event OrderEvent) []Trigger {
+	for _, t := range e.triggers {
+		if t.Type != TriggerLimitOrder || t.OrderId != event.OrderId || t.State != TriggerActive {
+			continue
+		}
+		e.untrack(t)
+		t.Updated = time.Now().UTC()
+		if event.Filled <= 0 {
+			// cancelled outside of the engine
+			t.State = TriggerCancelled
+			return nil
+		}
+		t.State = TriggerFired
+		if len(event.Trades) > 0 {
+			t.FiredPrice = event.Trades[0].Price
+		}
+		return append([]Trigger{*t}, e.cancelGroup(t)...)
+	}
+	return nil
+}
+
+// cancelGroup cancels the rest of the OCO group of the fired trigger, including limit orders on the exchange.
+// It returns triggers whose limit orders couldn't be cancelled. Caller must hold the lock.
+func (e *TriggerEngine) cancelGroup(t *Trigger) []Trigger {
+	if t.Group == "" {
+		return nil
+	}
+	var failed []Trigger
+	for _, other := range e.triggers {
+		if other.Group != t.Group || other.Id == t.Id || other.State != TriggerActive {
+			continue
+		}
+		other.State, other.Updated = TriggerCancelled, t.Updated
+		if other.Type != TriggerLimitOrder {
+			continue
+		}
+		e.untrack(other)
+		if _, err := e.trader.OrderCancel(other.OrderId); err != nil {
+			other.State, other.Error = TriggerFailed, "cancel order: "+err.Error()
+			failed = append(failed, *other)
+		}
+	}
+	return failed
+}
+
+// track starts following the limit order of the active trigger.
+func (e *TriggerEngine) track(t *Trigger) {
+	if t.Type == TriggerLimitOrder && t.State == TriggerActive {
+		q, _ := strconv.ParseFloat(t.Quantity, 64)
+		e.tracker.Track(t.OrderId, t.Pair, q)
+	}
+}
+
+// untrack stops following the limit order of the trigger.
+func (e *TriggerEngine) untrack(t *Trigger) {
+	if t.Type == TriggerLimitOrder {
+		e.tracker.Untrack(t.OrderId)
+	}
+}
+
+// sorted returns copies of triggers ordered by creation. Caller must hold the lock.
+func (e *TriggerEngine) sorted() []Trigger {
+	triggers := make([]Trigger, 0, len(e.triggers))
+	for _, t := range e.triggers {
+		triggers = append(triggers, *t)
+	}
+	sort.Slice(triggers, func(i, j int) bool {
+		if !triggers[i].Created.Equal(triggers[j].Created) {
+			return triggers[i].Created.Before(triggers[j].Created)
+		}
+		return triggers[i].Id < triggers[j].Id
+	})
+	return triggers
+}
+
+// save writes all triggers to the state file. Caller must hold the lock.
+func (e *TriggerEngine) save() error {
+	if e.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(e.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(e.path, data)
+}
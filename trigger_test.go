@@ -0,0 +1,256 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setBidAsk sets the best prices of BTC_RUB in the ticker.
+func setBidAsk(m *stubMarket, bid, ask string) {
+	m.ticker = `{"BTC_RUB":{"buy_price":"` + bid + `","sell_price":"` + ask + `","last_trade":"` + bid + `","updated":1570000000}}`
+}
+
+func TestTriggerEngine(t *testing.T) {
+	t.Run("OCO", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"BTC": 1})
+		e, err := NewTriggerEngine(p, market, "")
+		require.NoError(t, err)
+
+		added, err := e.AddOCO(
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerStopLoss, Quantity: "1", Price: 990000},
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerTakeProfit, Quantity: "1", Price: 1010000},
+		)
+		require.NoError(t, err)
+		require.Equal(t, added[0].Group, added[1].Group)
+
+		fired, err := e.Check()
+		require.NoError(t, err)
+		require.Empty(t, fired)
+
+		setBidAsk(market, "1015000", "1016000")
+		fired, err = e.Check()
+		require.NoError(t, err)
+		require.Len(t, fired, 1)
+		require.Equal(t, TriggerTakeProfit, fired[0].Type)
+		require.Equal(t, TriggerFired, fired[0].State)
+		require.NotEmpty(t, fired[0].OrderId)
+		require.Equal(t, 1015000.0, fired[0].FiredPrice)
+		require.InDelta(t, 0, paperBalance(t, p, "balances", "BTC"), 1e-12)
+
+		triggers := e.Triggers()
+		require.Equal(t, TriggerCancelled, triggers[0].State)
+
+		// the stop loss was cancelled with its sibling
+		setBidAsk(market, "900000", "901000")
+		fired, err = e.Check()
+		require.NoError(t, err)
+		require.Empty(t, fired)
+	})
+
+	t.Run("OCOLimitOrder", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"BTC": 2})
+		e, err := NewTriggerEngine(p, market, "")
+		require.NoError(t, err)
+
+		// take profit rests in the book as a limit order, stop loss is watched by the engine
+		resp, err := p.Sell("BTC_RUB", "1", "1010000")
+		require.NoError(t, err)
+		orderId, _ := orderIdOf(resp)
+		_, err = e.AddOCO(
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerStopLoss, Quantity: "1", Price: 990000},
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerLimitOrder, Quantity: "1", OrderId: orderId},
+		)
+		require.NoError(t, err)
+		fired, err := e.Check()
+		require.NoError(t, err)
+		require.Empty(t, fired)
+
+		// the stop fires and the limit order is cancelled
+		setBidAsk(market, "980000", "981000")
+		fired, err = e.Check()
+		require.NoError(t, err)
+		require.Len(t, fired, 1)
+		require.Equal(t, TriggerStopLoss, fired[0].Type)
+		triggers := e.Triggers()
+		require.Equal(t, TriggerCancelled, triggers[1].State)
+		open, err := p.GetUserOpenOrders()
+		require.NoError(t, err)
+		require.Empty(t, open)
+		require.InDelta(t, 1, paperBalance(t, p, "balances", "BTC"), 1e-12)
+
+		// the limit order fills and the stop is cancelled
+		setBidAsk(market, "999000", "1000000")
+		resp, err = p.Sell("BTC_RUB", "1", "1010000")
+		require.NoError(t, err)
+		orderId, _ = orderIdOf(resp)
+		_, err = e.AddOCO(
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerStopLoss, Quantity: "1", Price: 990000},
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerLimitOrder, Quantity: "1", OrderId: orderId},
+		)
+		require.NoError(t, err)
+		market.books["BTC_RUB"] = `{"ask":[["1030000","1","1030000"]],"bid":[["1020000","2","2040000"]]}`
+		require.NoError(t, p.Sync())
+
+		fired, err = e.Check()
+		require.NoError(t, err)
+		require.Len(t, fired, 1)
+		require.Equal(t, TriggerLimitOrder, fired[0].Type)
+		require.Equal(t, TriggerFired, fired[0].State)
+		require.Equal(t, 1010000.0, fired[0].FiredPrice)
+		triggers = e.Triggers()
+		require.Equal(t, TriggerCancelled, triggers[2].State)
+
+		setBidAsk(market, "900000", "901000")
+		fired, err = e.Check()
+		require.NoError(t, err)
+		require.Empty(t, fired)
+		require.InDelta(t, 0, paperBalance(t, p, "balances", "BTC"), 1e-12)
+	})
+
+	t.Run("TrailingStop", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"BTC": 1})
+		e, err := NewTriggerEngine(p, market, "")
+		require.NoError(t, err)
+		_, err = e.Add(Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerTrailingStop, Quantity: "0.5", TrailPercent: 1})
+		require.NoError(t, err)
+
+		for _, bid := range []string{"999000", "1100000", "1090000"} {
+			setBidAsk(market, bid, "1200000")
+			fired, err := e.Check()
+			require.NoError(t, err)
+			require.Empty(t, fired)
+		}
+		require.Equal(t, 1100000.0, e.Triggers()[0].Extreme)
+
+		setBidAsk(market, "1088000", "1200000")
+		fired, err := e.Check()
+		require.NoError(t, err)
+		require.Len(t, fired, 1)
+		require.InDelta(t, 0.5, paperBalance(t, p, "balances", "BTC"), 1e-12)
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		market := newStubMarket()
+		p := NewPaper(market, nil)
+		e, err := NewTriggerEngine(p, market, "")
+		require.NoError(t, err)
+		_, err = e.Add(Trigger{Pair: "BTC_RUB", Side: "buy", Type: TriggerStopLoss, Quantity: "1", Price: 1000000})
+		require.NoError(t, err)
+
+		fired, err := e.Check()
+		require.NoError(t, err)
+		require.Len(t, fired, 1)
+		require.Equal(t, TriggerFailed, fired[0].State)
+		require.Equal(t, ErrInsufficientFunds.Error(), fired[0].Error)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		e, err := NewTriggerEngine(nil, nil, "")
+		require.NoError(t, err)
+		_, err = e.Add(Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerTrailingStop, Quantity: "1"})
+		require.Error(t, err)
+		_, err = e.Add(Trigger{Pair: "BTC_RUB", Side: "hold", Type: TriggerStopLoss, Quantity: "1", Price: 1})
+		require.Error(t, err)
+		_, err = e.AddOCO(Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerStopLoss, Quantity: "1", Price: 1})
+		require.Error(t, err)
+		_, err = e.Add(Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerLimitOrder, Quantity: "1", OrderId: "1"})
+		require.Error(t, err)
+		_, err = e.AddOCO(
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerStopLoss, Quantity: "1", Price: 1},
+			Trigger{Pair: "BTC_RUB", Side: "sell", Type: TriggerLimitOrder, Quantity: "1"},
+		)
+		require.Error(t, err)
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "exmo")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "triggers.json")
+
+		market := newStubMarket()
+		p := NewPaper(market, map[string]float64{"BTC": 1})
+		e, err := NewTriggerEngine(p, market, path)
+		require.NoError(t, err)
+		_, err = e.Add(Trigger{Id: "trail", Pair: "BTC_RUB", Side: "sell", Type: TriggerTrailingStop, Quantity: "1", TrailPercent: 5})
+		require.NoError(t, err)
+		setBidAsk(market, "1100000", "1200000")
+		_, err = e.Check()
+		require.NoError(t, err)
+
+		// the trailing extreme survives restart
+		e, err = NewTriggerEngine(p, market, path)
+		require.NoError(t, err)
+		require.Equal(t, 1100000.0, e.Triggers()[0].Extreme)
+		setBidAsk(market, "1040000", "1200000")
+		fired, err := e.Check()
+		require.NoError(t, err)
+		require.Len(t, fired, 1)
+
+		// a trigger interrupted while placing the order is not fired again
+		var saved []Trigger
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &saved))
+		saved[0].State = TriggerFiring
+		data, _ = json.Marshal(saved)
+		require.NoError(t, ioutil.WriteFile(path, data, 0644))
+
+		e, err = NewTriggerEngine(p, market, path)
+		require.NoError(t, err)
+		require.Equal(t, TriggerFailed, e.Triggers()[0].State)
+		require.NotEmpty(t, e.Triggers()[0].Error)
+
+		// the link between a stop and a limit order survives restart
+		setBidAsk(market, "999000", "1000000")
+		p = NewPaper(market, map[string]float64{"BTC": 2})
+		resp, err := p.Sell("BTC_RUB", "1", "1010000")
+		require.NoError(t, err)
+		orderId, _ := orderIdOf(resp)
+		e, err = NewTriggerEngine(p, market, path)
+		require.NoError(t, err)
+		_, err = e.AddOCO(
+			Trigger{Id: "stop", Pair: "BTC_RUB", Side: "sell", Type: TriggerStopLoss, Quantity: "1", Price: 990000},
+			Trigger{Id: "limit", Pair: "BTC_RUB", Side: "sell", Type: TriggerLimitOrder, Quantity: "1", OrderId: orderId},
+		)
+		require.NoError(t, err)
+
+		e, err = NewTriggerEngine(p, market, path)
+		require.NoError(t, err)
+		market.books["BTC_RUB"] = `{"ask":[["1030000","1","1030000"]],"bid":[["1020000","2","2040000"]]}`
+		require.NoError(t, p.Sync())
+		fired, err = e.Check()
+		require.NoError(t, err)
+		require.Len(t, fired, 1)
+		require.Equal(t, "limit", fired[0].Id)
+		for _, trigger := range e.Triggers() {
+			if trigger.Id == "stop" {
+				require.Equal(t, TriggerCancelled, trigger.State)
+			}
+		}
+	})
+}
@@ -0,0 +1,159 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OrderValidationError describes order parameter that violates pair settings.
+type OrderValidationError struct {
+	Pair  string
+	Field string // quantity, price, amount or type
+	Value string // offending value
+	Rule  string // violated pair setting, e.g. min_quantity; empty if the value is malformed
+	Limit string // value of the violated pair setting
+}
+
+func (e *OrderValidationError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("%s order %s %q is invalid", e.Pair, e.Field, e.Value)
+	}
+	return fmt.Sprintf("%s order %s %s violates %s %s", e.Pair, e.Field, e.Value, e.Rule, e.Limit)
+}
+
+// settingsCache keeps parsed pair settings shared between copies of Exmo instance.
+type settingsCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	fetched  time.Time
+	settings map[string]PairSettings
+}
+
+// CachedPairSettings returns settings of the pair. GetPairSettings is requested only when the cache is empty or expired.
+func (ex *Exmo) CachedPairSettings(pair string) (PairSettings, error) {
+	all, err := ex.CachedAllPairSettings()
+	if err != nil {
+		return PairSettings{}, err
+	}
+	settings, ok := all[pair]
+	if !ok {
+		return PairSettings{}, fmt.Errorf("unknown currency pair %s", pair)
+	}
+	return settings, nil
+}
+
+// CachedAllPairSettings returns settings of all pairs. GetPairSettings is requested only when the cache is empty or expired.
+func (ex *Exmo) CachedAllPairSettings() (map[string]PairSettings, error) {
+	cache := ex.settings
+	if cache == nil {
+		cache = &settingsCache{}
+		ex.settings = cache
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.settings == nil || (cache.ttl > 0 && time.Since(cache.fetched) > cache.ttl) {
+		resp, err := ex.GetPairSettings()
+		if err != nil {
+			return nil, err
+		}
+		settings, err := ParsePairSettings(resp)
+		if err != nil {
+			return nil, err
+		}
+		cache.settings = settings
+		cache.fetched = time.Now()
+	}
+
+	return cache.settings, nil
+}
+
+// ValidateOrder checks order params against pair settings and returns them normalized
+// to the format expected by the API. Violations are reported as *OrderValidationError.
+func ValidateOrder(settings PairSettings, pair string, quantity string, price string, typeOrder string) (string, string, error) {
+	q, err := strconv.ParseFloat(strings.TrimSpace(quantity), 64)
+	if err != nil || q <= 0 || math.IsInf(q, 0) || math.IsNaN(q) {
+		return "", "", &OrderValidationError{Pair: pair, Field: "quantity", Value: quantity}
+	}
+
+	switch typeOrder {
+	case "buy", "sell":
+		p, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+		if err != nil || p <= 0 || math.IsInf(p, 0) || math.IsNaN(p) {
+			return "", "", &OrderValidationError{Pair: pair, Field: "price", Value: price}
+		}
+		if err := checkRange(pair, "quantity", q, "min_quantity", settings.MinQuantity, "max_quantity", settings.MaxQuantity); err != nil {
+			return "", "", err
+		}
+		if err := checkRange(pair, "price", p, "min_price", settings.MinPrice, "max_price", settings.MaxPrice); err != nil {
+			return "", "", err
+		}
+		if err := checkRange(pair, "amount", q*p, "min_amount", settings.MinAmount, "max_amount", settings.MaxAmount); err != nil {
+			return "", "", err
+		}
+		if settings.PricePrecision >= 0 && decimals(p) > settings.PricePrecision {
+			return "", "", &OrderValidationError{
+				Pair: pair, Field: "price", Value: formatFloat(p),
+				Rule: "price_precision", Limit: strconv.Itoa(settings.PricePrecision),
+			}
+		}
+		return formatFloat(q), formatFloat(p), nil
+	case "market_buy", "market_sell":
+		if err := checkRange(pair, "quantity", q, "min_quantity", settings.MinQuantity, "max_quantity", settings.MaxQuantity); err != nil {
+			return "", "", err
+		}
+		return formatFloat(q), "0", nil
+	case "market_buy_total", "market_sell_total":
+		// quantity of *_total orders is amount in quote currency
+		if err := checkRange(pair, "amount", q, "min_amount", settings.MinAmount, "max_amount", settings.MaxAmount); err != nil {
+			return "", "", err
+		}
+		return formatFloat(q), "0", nil
+	default:
+		return "", "", &OrderValidationError{Pair: pair, Field: "type", Value: typeOrder}
+	}
+}
+
+// checkRange checks value against min and max limits; zero limit is not checked.
+func checkRange(pair, field string, value float64, minRule string, min float64, maxRule string, max float64) error {
+	// tolerance for products like quantity*price that are not exact in binary floating point
+	const tolerance = 1e-9
+
+	if min > 0 && value < min*(1-tolerance) {
+		return &OrderValidationError{Pair: pair, Field: field, Value: formatFloat(value), Rule: minRule, Limit: formatFloat(min)}
+	}
+	if max > 0 && value > max*(1+tolerance) {
+		return &OrderValidationError{Pair: pair, Field: field, Value: formatFloat(value), Rule: maxRule, Limit: formatFloat(max)}
+	}
+	return nil
+}
+
+// decimals returns the number of digits after decimal point in the shortest representation of the number.
+func decimals(f float64) int {
+	s := formatFloat(f)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOrder(t *testing.T) {
+	settings, err := ParsePairSettings(decodeResponse(testPairSettings))
+	require.NoError(t, err)
+	btc := settings["BTC_RUB"]
+
+	for _, tc := range []struct {
+		name      string
+		quantity  string
+		price     string
+		typeOrder string
+		field     string
+		rule      string
+	}{
+		{"MalformedQuantity", "abc", "1000000", "buy", "quantity", ""},
+		{"NegativeQuantity", "-1", "1000000", "buy", "quantity", ""},
+		{"MalformedPrice", "0.01", "", "sell", "price", ""},
+		{"MinQuantity", "0.0001", "1000000", "buy", "quantity", "min_quantity"},
+		{"MaxQuantity", "101", "1000000", "buy", "quantity", "max_quantity"},
+		{"MinPrice", "0.01", "0.5", "buy", "price", "min_price"},
+		{"MaxPrice", "0.01", "20000000", "sell", "price", "max_price"},
+		{"MinAmount", "0.001", "5000", "buy", "amount", "min_amount"},
+		{"PricePrecision", "0.01", "1000000.123", "buy", "price", "price_precision"},
+		{"MarketQuantity", "0.0001", "0", "market_sell", "quantity", "min_quantity"},
+		{"MarketTotalAmount", "5", "0", "market_buy_total", "amount", "min_amount"},
+		{"UnknownType", "1", "1", "stop", "type", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := ValidateOrder(btc, "BTC_RUB", tc.quantity, tc.price, tc.typeOrder)
+			require.Error(t, err)
+			validationErr, ok := err.(*OrderValidationError)
+			require.True(t, ok, "unexpected error type %T", err)
+			require.Equal(t, tc.field, validationErr.Field)
+			require.Equal(t, tc.rule, validationErr.Rule)
+		})
+	}
+
+	t.Run("Normalize", func(t *testing.T) {
+		quantity, price, err := ValidateOrder(btc, "BTC_RUB", " 1.50e-2 ", "1000000.10", "buy")
+		require.NoError(t, err)
+		require.Equal(t, "0.015", quantity)
+		require.Equal(t, "1000000.1", price)
+
+		quantity, price, err = ValidateOrder(btc, "BTC_RUB", "100.00", "", "market_buy_total")
+		require.NoError(t, err)
+		require.Equal(t, "100", quantity)
+		require.Equal(t, "0", price)
+	})
+}
+
+func TestOrderCreateValidation(t *testing.T) {
+	calls := map[string]int{}
+	api := stubApi(func(method string, params url.Values) string {
+		calls[method]++
+		switch method {
+		case "pair_settings":
+			return testPairSettings
+		case "order_create":
+			require.Equal(t, "0.015", params.Get("quantity"))
+			return `{"result":true,"error":"","order_id":42}`
+		}
+		return `{}`
+	}, WithOrderValidation(0))
+
+	_, err := api.Buy("BTC_RUB", "0.0001", "1000000")
+	_, ok := err.(*OrderValidationError)
+	require.True(t, ok)
+
+	_, err = api.Buy("ETH_USD", "1", "100")
+	require.Error(t, err)
+
+	order, err := api.Buy("BTC_RUB", "0.0150", "1000000")
+	require.NoError(t, err)
+	require.Equal(t, 42.0, order["order_id"])
+
+	require.Equal(t, 1, calls["pair_settings"])
+	require.Equal(t, 1, calls["order_create"])
+}
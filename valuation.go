@@ -0,0 +1,210 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"fmt"
+	"sort"
+)
+
+// AssetValue is the value of holdings of a single currency.
+type AssetValue struct {
+	Currency string
+	Balance  float64  // available
+	Reserved float64  // in open orders
+	Total    float64  // Balance + Reserved
+	Price    float64  // price of one unit in the quote currency
+	Value    float64  // Total * Price
+	Route    []string // pairs used to price the currency, empty for the quote currency itself
+	Priced   bool     // false if there is no route to the quote currency
+}
+
+// Valuation is the value of the account in a quote currency.
+type Valuation struct {
+	Quote    string
+	Assets   []AssetValue // non-zero holdings ordered by value, the biggest first
+	Total    float64
+	Unpriced []string // currencies with holdings that could not be priced
+}
+
+// maxValuationHops is the maximal number of pairs used to price a currency.
+const maxValuationHops = 3
+
+// Valuate prices balances and reserved funds from GetUserInfo response in the quote currency with ticker prices.
+// Currencies without direct pair are priced through intermediate pairs (e.g. XRP -> BTC -> RUB) using
+// the shortest route. Holdings are valued at the price they can be sold at: best bid of base/quote pairs
+// and inverse best ask of quote/base pairs, last trade price is used when the book side is empty.
+func Valuate(userInfo ApiResponse, ticker map[string]TickerItem, quote string) (Valuation, error) {
+	balances, err := parseAmounts(userInfo["balances"])
+	if err != nil {
+		return Valuation{}, fmt.Errorf("balances: %s", err)
+	}
+	reserved, err := parseAmounts(userInfo["reserved"])
+	if err != nil {
+		return Valuation{}, fmt.Errorf("reserved: %s", err)
+	}
+
+	currencies := map[string]bool{}
+	for currency := range balances {
+		currencies[currency] = true
+	}
+	for currency := range reserved {
+		currencies[currency] = true
+	}
+
+	rates := tickerRates(ticker)
+	v := Valuation{Quote: quote}
+	for currency := range currencies {
+		a := AssetValue{Currency: currency, Balance: balances[currency], Reserved: reserved[currency]}
+		a.Total = a.Balance + a.Reserved
+		if a.Total == 0 {
+			continue
+		}
+
+		a.Price, a.Route, a.Priced = rates.convert(currency, quote, maxValuationHops)
+		if a.Priced {
+			a.Value = a.Total * a.Price
+			v.Total += a.Value
+		} else {
+			v.Unpriced = append(v.Unpriced, currency)
+		}
+		v.Assets = append(v.Assets, a)
+	}
+
+	sort.Slice(v.Assets, func(i, j int) bool {
+		if v.Assets[i].Value != v.Assets[j].Value {
+			return v.Assets[i].Value > v.Assets[j].Value
+		}
+		return v.Assets[i].Currency < v.Assets[j].Currency
+	})
+	sort.Strings(v.Unpriced)
+	return v, nil
+}
+
+// Valuate requests balances and ticker and values the account in the quote currency, see Valuate function.
+func (ex *Exmo) Valuate(quote string) (Valuation, error) {
+	userInfo, err := ex.GetUserInfo()
+	if err != nil {
+		return Valuation{}, err
+	}
+	resp, err := ex.Ticker()
+	if err != nil {
+		return Valuation{}, err
+	}
+	ticker, err := ParseTicker(resp)
+	if err != nil {
+		return Valuation{}, err
+	}
+	return Valuate(userInfo, ticker, quote)
+}
+
+// rateEdge is a conversion of one currency to another through a pair.
+type rateEdge struct {
+	to   string
+	pair string
+	rate float64
+}
+
+// rateGraph maps currency to its conversions.
+type rateGraph map[string][]rateEdge
+
+// tickerRates builds conversion rates from ticker: base -> quote at bid, quote -> base at 1/ask.
+func tickerRates(ticker map[string]TickerItem) rateGraph {
+	g := rateGraph{}
+	pairs := make([]string, 0, len(ticker))
+	for pair := range ticker {
+		pairs = append(pairs, pair)
+	}
+	// stable routes for equally short paths
+	sort.Strings(pairs)
+
+	for _, pair := range pairs {
+		base, quote, err := SplitPair(pair)
+		if err != nil {
+			continue
+		}
+		item := ticker[pair]
+		bid, ask := item.BuyPrice, item.SellPrice
+		if bid <= 0 {
+			bid = item.LastTrade
+		}
+		if ask <= 0 {
+			ask = item.LastTrade
+		}
+		if bid > 0 {
+			g[base] = append(g[base], rateEdge{to: quote, pair: pair, rate: bid})
+		}
+		if ask > 0 {
+			g[quote] = append(g[quote], rateEdge{to: base, pair: pair, rate: 1 / ask})
+		}
+	}
+	return g
+}
+
+// convert finds the shortest route from one currency to another (breadth-first, at most maxHops pairs)
+// and returns the rate along it.
+func (g rateGraph) convert(from, to string, maxHops int) (float64, []string, bool) {
+	if from == to {
+		return 1, nil, true
+	}
+
+	type step struct {
+		currency string
+		rate     float64
+		route    []string
+	}
+	visited := map[string]bool{from: true}
+	level := []step{{currency: from, rate: 1}}
+	for hop := 0; hop < maxHops && len(level) > 0; hop++ {
+		var next []step
+		for _, s := range level {
+			for _, e := range g[s.currency] {
+				if visited[e.to] {
+					continue
+				}
+				route := append(append([]string(nil), s.route...), e.pair)
+				if e.to == to {
+					return s.rate * e.rate, route, true
+				}
+				visited[e.to] = true
+				next = append(next, step{currency: e.to, rate: s.rate * e.rate, route: route})
+			}
+		}
+		level = next
+	}
+	return 0, nil, false
+}
+
+// parseAmounts converts balances or reserved map of GetUserInfo response.
+func parseAmounts(value interface{}) (map[string]float64, error) {
+	amounts := map[string]float64{}
+	if value == nil {
+		return amounts, nil
+	}
+	fields, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected format")
+	}
+	for currency, v := range fields {
+		amount, err := toFloat(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", currency, err)
+		}
+		amounts[currency] = amount
+	}
+	return amounts, nil
+}
@@ -0,0 +1,90 @@
+/*
+   Copyright 2019 Vadim Inshakov
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package exmo
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValuate(t *testing.T) {
+	ticker, err := ParseTicker(decodeResponse(testTicker))
+	require.NoError(t, err)
+	ticker["XRP_BTC"] = TickerItem{BuyPrice: 0.00003, SellPrice: 0.000031}
+
+	userInfo := decodeResponse(`{
+		"balances": {"BTC":"1","ETH":"2","RUB":"1000","XRP":"100","DOGE":"5","USD":"0"},
+		"reserved": {"BTC":"0.5","ETH":"0","RUB":"0","XRP":"0","DOGE":"0","USD":"0"}
+	}`)
+
+	t.Run("Routes", func(t *testing.T) {
+		v, err := Valuate(userInfo, ticker, "RUB")
+		require.NoError(t, err)
+		require.Equal(t, "RUB", v.Quote)
+		require.Equal(t, []string{"DOGE"}, v.Unpriced)
+		require.Len(t, v.Assets, 5)
+
+		btc := v.Assets[0]
+		require.Equal(t, "BTC", btc.Currency)
+		require.Equal(t, 1.5, btc.Total)
+		require.Equal(t, []string{"BTC_RUB"}, btc.Route)
+		require.InDelta(t, 1498500, btc.Value, 1e-6)
+
+		eth := v.Assets[1]
+		require.Equal(t, "ETH", eth.Currency)
+		require.Equal(t, []string{"ETH_RUB"}, eth.Route, "direct pair is preferred")
+		require.InDelta(t, 39800, eth.Value, 1e-6)
+
+		xrp := v.Assets[2]
+		require.Equal(t, "XRP", xrp.Currency)
+		require.Equal(t, []string{"XRP_BTC", "BTC_RUB"}, xrp.Route)
+		require.InDelta(t, 100*0.00003*999000, xrp.Value, 1e-6)
+
+		rub := v.Assets[3]
+		require.Equal(t, "RUB", rub.Currency)
+		require.Empty(t, rub.Route)
+		require.Equal(t, 1.0, rub.Price)
+
+		require.False(t, v.Assets[4].Priced)
+		require.InDelta(t, 1498500+39800+1000+2997, v.Total, 1e-6)
+	})
+
+	t.Run("InverseRate", func(t *testing.T) {
+		v, err := Valuate(userInfo, ticker, "BTC")
+		require.NoError(t, err)
+		for _, a := range v.Assets {
+			if a.Currency == "RUB" {
+				require.Equal(t, []string{"BTC_RUB"}, a.Route)
+				require.InDelta(t, 1000.0/1000000, a.Value, 1e-12)
+			}
+		}
+	})
+
+	t.Run("Api", func(t *testing.T) {
+		api := stubApi(func(method string, params url.Values) string {
+			if method == "ticker" {
+				return testTicker
+			}
+			return `{"balances":{"BTC":"0.1","RUB":"500"},"reserved":{"BTC":"0","RUB":"100"}}`
+		})
+		v, err := api.Valuate("RUB")
+		require.NoError(t, err)
+		require.InDelta(t, 99900+600, v.Total, 1e-6)
+	})
+}